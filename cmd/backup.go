@@ -0,0 +1,95 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/insightsengineering/git-synchronizer/synchronizer"
+	"github.com/spf13/cobra"
+)
+
+func newBackupCommand() *cobra.Command {
+	var directory string
+	var options synchronizer.BackupOptions
+	backupCmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Write timestamped snapshots of the source repositories.",
+		Long: `Clone every source repository and write its snapshot, either a git bundle or a compressed
+bare repository, together with a manifest listing its refs and checksum, to the backup directory.
+Snapshots not covered by the retention rules are removed.`,
+		Run: func(cmd *cobra.Command, _ []string) {
+			validateConfiguration()
+			repositories := prepareRepositories()
+			result, err := newSyncer().Backup(cmd.Context(), repositories, directory, options)
+			reportResult(result, err, failOn)
+		},
+	}
+	backupCmd.Flags().StringVarP(&directory, "directory", "d", "backups",
+		"Directory where snapshots and their manifests are stored.")
+	backupCmd.Flags().StringVar(&options.Format, "format", synchronizer.BackupFormatBundle,
+		"Snapshot format: bundle or archive (gzip-compressed tar archive of a bare repository).")
+	backupCmd.Flags().IntVar(&options.KeepDaily, "keepDaily", 7,
+		"Number of days for which the most recent snapshot of each day is kept.")
+	backupCmd.Flags().IntVar(&options.KeepWeekly, "keepWeekly", 4,
+		"Number of weeks for which the most recent snapshot of each week is kept.")
+	return backupCmd
+}
+
+// restorePair returns the repository pair to which the snapshot described by manifest is restored.
+// Settings of the repository pair configured with the same destination are used if there is one,
+// otherwise the default settings apply.
+func restorePair(manifest synchronizer.SnapshotManifest, destination string) synchronizer.RepositoryPair {
+	if destination == "" {
+		destination = manifest.Destination
+	}
+	for _, repository := range prepareRepositories() {
+		if repository.Destination.RepositoryURL == destination {
+			repository.Source.RepositoryURL = manifest.Source
+			return repository
+		}
+	}
+	config := synchronizer.Config{Defaults: defaultSettings, Repositories: []synchronizer.RepositoryPair{{
+		Source:      synchronizer.Repository{RepositoryURL: manifest.Source},
+		Destination: synchronizer.Repository{RepositoryURL: destination},
+	}}}
+	return config.Resolve()[0]
+}
+
+func newRestoreCommand() *cobra.Command {
+	var destination string
+	restoreCmd := &cobra.Command{
+		Use:   "restore <snapshot-manifest>",
+		Short: "Push a snapshot written by backup to a destination repository.",
+		Long: `Verify the checksum of the snapshot described by the manifest and push its branches and tags
+to the destination repository, which is the one the snapshot has been taken for unless --destination is given.
+Branches and tags not present in the snapshot are removed from the destination, according to the ref policy.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			validateConfiguration()
+			manifest, err := synchronizer.ReadSnapshotManifest(args[0])
+			if err != nil {
+				log.Error(err)
+				os.Exit(exitCodeConfigError)
+			}
+			result, err := newSyncer().Restore(cmd.Context(), args[0], restorePair(manifest, destination))
+			reportResult(result, err, failOn)
+		},
+	}
+	restoreCmd.Flags().StringVar(&destination, "destination", "",
+		"URL of the repository to which the snapshot is restored.")
+	return restoreCmd
+}
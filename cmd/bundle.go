@@ -0,0 +1,64 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newBundleCommand() *cobra.Command {
+	var directory string
+	var full bool
+	bundleCmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Synchronize repositories through git bundles, e.g. across an air gap.",
+		Long: `Export the source repositories to git bundles, transfer the bundle directory by any means,
+and import the bundles to the destination repositories.`,
+	}
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write a git bundle and a manifest for each source repository.",
+		Long: `Clone every source repository and write a git bundle with its branches and tags, together with
+a manifest listing the refs, to the bundle directory. Bundles only contain objects which have not been
+exported in previous runs, as recorded in the working directory, unless --full is given. Earlier bundles
+are kept until a full bundle replaces them.`,
+		Run: func(cmd *cobra.Command, _ []string) {
+			validateConfiguration()
+			repositories := prepareRepositories()
+			result, err := newSyncer().ExportBundles(cmd.Context(), repositories, directory, full)
+			reportResult(result, err, failOn)
+		},
+	}
+	exportCmd.Flags().BoolVar(&full, "full", false,
+		"Include all objects in the bundles, regardless of what has been exported before.")
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Push branches and tags from git bundles to the destination repositories.",
+		Long: `Read bundles written by bundle export, starting from the latest full bundle of each repository, and
+update every destination repository like a regular synchronization would: branches and tags are created and
+updated, and the ones not present in the latest bundle are removed, according to the ref policy.`,
+		Run: func(cmd *cobra.Command, _ []string) {
+			validateConfiguration()
+			repositories := prepareRepositories()
+			result, err := newSyncer().ImportBundles(cmd.Context(), repositories, directory)
+			reportResult(result, err, failOn)
+		},
+	}
+	bundleCmd.PersistentFlags().StringVarP(&directory, "directory", "d", "bundles",
+		"Directory where bundles and their manifests are stored.")
+	bundleCmd.AddCommand(exportCmd, importCmd)
+	return bundleCmd
+}
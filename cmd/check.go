@@ -0,0 +1,61 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/insightsengineering/git-synchronizer/synchronizer"
+	"github.com/spf13/cobra"
+)
+
+// PrintCheckStatuses prints a table with check results and returns the number of repository pairs
+// which are not ready to be synchronized.
+func PrintCheckStatuses(statuses []synchronizer.CheckStatus) int {
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tREAD\tDESTINATION\tWRITE")
+	for _, s := range statuses {
+		fmt.Fprintln(w, s.Source+"\t"+s.SourceStatus+"\t"+s.Destination+"\t"+s.DestinationStatus)
+		if !s.OK() {
+			failed++
+		}
+	}
+	checkError(w.Flush())
+	return failed
+}
+
+func newCheckCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "check",
+		Short: "Check connectivity and permissions for all repositories.",
+		Long: `List refs in every source repository (read access) and every destination repository
+(write access) without cloning anything, and print which repository pairs are reachable.
+Exits with a non-zero status if any repository pair cannot be synchronized.`,
+		Run: func(cmd *cobra.Command, _ []string) {
+			validateConfiguration()
+			repositories := prepareRepositories()
+
+			failed := PrintCheckStatuses(newSyncer().Check(cmd.Context(), repositories))
+			if failed > 0 {
+				log.Error(failed, " out of ", len(repositories), " repository pairs cannot be synchronized.")
+				os.Exit(1)
+			}
+		},
+	}
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/insightsengineering/git-synchronizer/synchronizer"
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+)
+
+// configSource is a configuration file read directly from --config or included by another configuration file.
+type configSource struct {
+	Path string
+	// Content of the file as written, and the parsed document with variables expanded.
+	Data   []byte
+	Root   *yaml.Node
+	Config configFile
+	// Default settings of the file, with the ones of the including files applied.
+	Defaults synchronizer.RepositoryPair
+	// True for files matched by --config, false for included files.
+	TopLevel bool
+	// Variables defined in the file and the files including it.
+	Variables map[string]string
+}
+
+// configFiles returns configuration files matched by pattern, which is either a file, a directory
+// whose YAML files are returned, or a glob.
+func configFiles(pattern string) ([]string, error) {
+	var files []string
+	info, statErr := os.Stat(pattern)
+	if statErr == nil && info.IsDir() {
+		for _, extension := range []string{"*.yml", "*.yaml"} {
+			matches, _ := filepath.Glob(filepath.Join(pattern, extension))
+			files = append(files, matches...)
+		}
+		sort.Strings(files)
+	} else if strings.ContainsAny(pattern, "*?[") {
+		var globErr error
+		if files, globErr = filepath.Glob(pattern); globErr != nil {
+			return nil, globErr
+		}
+	} else if statErr != nil {
+		return nil, statErr
+	} else {
+		return []string{pattern}, nil
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no configuration files found in " + pattern)
+	}
+	return files, nil
+}
+
+// inheritDefaults returns defaults with unset values taken from parentDefaults.
+func inheritDefaults(defaults, parentDefaults synchronizer.RepositoryPair) synchronizer.RepositoryPair {
+	config := synchronizer.Config{Defaults: parentDefaults, Repositories: []synchronizer.RepositoryPair{defaults}}
+	return config.Resolve()[0]
+}
+
+// variableReference matches references to variables in configuration files, e.g. ${GITLAB_HOST}.
+var variableReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandVariables replaces references to variables in string values of node and its descendants with their values.
+// Variables not found in variables are read from the environment. References to undefined variables are reported
+// and left unchanged. Keys and comments are not expanded.
+func expandVariables(node *yaml.Node, variables map[string]string) []ConfigProblem {
+	var problems []ConfigProblem
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.ShortTag() != "!!str" {
+			return nil
+		}
+		node.Value = variableReference.ReplaceAllStringFunc(node.Value, func(reference string) string {
+			name := variableReference.FindStringSubmatch(reference)[1]
+			if value, ok := variables[name]; ok {
+				return value
+			}
+			if value, ok := os.LookupEnv(name); ok {
+				return value
+			}
+			problems = append(problems, ConfigProblem{node.Line, "variable " + name + " is not defined"})
+			return reference
+		})
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			problems = append(problems, expandVariables(node.Content[i], variables)...)
+		}
+	default:
+		for _, child := range node.Content {
+			problems = append(problems, expandVariables(child, variables)...)
+		}
+	}
+	return problems
+}
+
+// parseConfig parses configuration file data and expands references to variables defined in the file, or
+// in inherited, in its string values. Variables available to the files it includes are returned as well.
+func parseConfig(data []byte, inherited map[string]string) (*yaml.Node, map[string]string, []ConfigProblem) {
+	var root yaml.Node
+	// Syntax errors are reported by the validation.
+	_ = yaml.Unmarshal(data, &root)
+	var config configFile
+	_ = root.Decode(&config)
+	variables := maps.Clone(inherited)
+	if variables == nil {
+		variables = make(map[string]string)
+	}
+	maps.Copy(variables, config.Variables)
+	return &root, variables, expandVariables(&root, variables)
+}
+
+// configReader reads configuration files together with the files they include.
+type configReader struct {
+	sources  []configSource
+	problems []ConfigFileProblem
+	read     map[string]bool
+}
+
+// readConfigFiles reads configuration files matched by pattern, followed by the files each of them includes.
+// Paths of included files are relative to the including file, and may be directories or globs as well.
+// Files matched by pattern which are included by another one are only read where they are included, so that
+// the result does not depend on the order of the files. Problems preventing files from being read are returned,
+// but reading continues with the remaining files.
+func readConfigFiles(pattern string) ([]configSource, []ConfigFileProblem) {
+	files, err := configFiles(pattern)
+	if err != nil {
+		return nil, []ConfigFileProblem{{pattern, ConfigProblem{0, err.Error()}}}
+	}
+	// Files read when starting from each file, including the file itself.
+	reached := make(map[string]map[string]bool)
+	for _, file := range files {
+		probe := configReader{read: make(map[string]bool)}
+		probe.readFile(file, nil)
+		reached[filepath.Clean(file)] = probe.read
+	}
+	reader := configReader{read: make(map[string]bool)}
+	for _, file := range files {
+		if !reader.read[filepath.Clean(file)] && !includedByOther(filepath.Clean(file), reached) {
+			reader.readFile(file, nil)
+		}
+	}
+	return reader.sources, reader.problems
+}
+
+// includedByOther returns true if file is included, directly or not, by another file which it does not include
+// itself. reached lists the files read when starting from each file.
+func includedByOther(file string, reached map[string]map[string]bool) bool {
+	for other, files := range reached {
+		if other != file && files[file] && !reached[file][other] {
+			return true
+		}
+	}
+	return false
+}
+
+// readFile reads the configuration file at path, included by parent unless it is nil, and the files it includes.
+// References to variables are expanded in string values of the parsed file.
+func (r *configReader) readFile(path string, parent *configSource) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		r.problems = append(r.problems, ConfigFileProblem{path, ConfigProblem{0, "Cannot read configuration file: " +
+			err.Error()}})
+		return
+	}
+	r.read[filepath.Clean(path)] = true
+	source := configSource{Path: path, Data: data, TopLevel: parent == nil}
+	var parentDefaults synchronizer.RepositoryPair
+	var parentVariables map[string]string
+	if parent != nil {
+		parentDefaults, parentVariables = parent.Defaults, parent.Variables
+	}
+	root, variables, problems := parseConfig(data, parentVariables)
+	for _, p := range problems {
+		r.problems = append(r.problems, ConfigFileProblem{path, p})
+	}
+	source.Root, source.Variables = root, variables
+	_ = root.Decode(&source.Config)
+	source.Defaults = inheritDefaults(source.Config.Defaults, parentDefaults)
+	r.sources = append(r.sources, source)
+	r.readIncludes(source)
+}
+
+// readIncludes reads the files included by source.
+func (r *configReader) readIncludes(source configSource) {
+	includeNodes := findYAMLKey(source.Root, "include")
+	for i, include := range source.Config.Include {
+		line := 0
+		if includeNodes != nil && i < len(includeNodes.Content) {
+			line = includeNodes.Content[i].Line
+		}
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(source.Path), include)
+		}
+		includedFiles, err := configFiles(include)
+		if err != nil {
+			r.problems = append(r.problems, ConfigFileProblem{source.Path, ConfigProblem{line, err.Error()}})
+		}
+		for _, includedFile := range includedFiles {
+			if r.read[filepath.Clean(includedFile)] {
+				r.problems = append(r.problems, ConfigFileProblem{source.Path,
+					ConfigProblem{line, includedFile + " is included more than once"}})
+				continue
+			}
+			r.readFile(includedFile, &source)
+		}
+	}
+}
+
+// configPattern returns the value of --config, or the path of the configuration file found in the home directory.
+func configPattern() string {
+	if cfgFile != "" {
+		return cfgFile
+	}
+	return viper.ConfigFileUsed()
+}
+
+// loadedConfig is the combined content of all configuration files.
+type loadedConfig struct {
+	repositories []synchronizer.RepositoryPair
+	notifiers    []synchronizer.NotifierConfig
+	// Default settings of the file matched by --config, if there is only one.
+	defaults synchronizer.RepositoryPair
+	// Paths of all files read, including the included ones.
+	files []string
+}
+
+// readConfig reads repositories and notifiers from all configuration files. Default settings of each file
+// are applied to the repositories it lists and to the ones listed by the files it includes.
+func readConfig(pattern string) (loadedConfig, error) {
+	sources, problems := readConfigFiles(pattern)
+	if len(problems) > 0 {
+		return loadedConfig{}, errors.New(problems[0].String())
+	}
+	var config loadedConfig
+	topLevel := 0
+	for _, source := range sources {
+		resolved := synchronizer.Config{Defaults: source.Defaults, Repositories: source.Config.Repositories}
+		config.repositories = append(config.repositories, resolved.Resolve()...)
+		config.notifiers = append(config.notifiers, source.Config.Notifications...)
+		config.files = append(config.files, source.Path)
+		if source.TopLevel {
+			topLevel++
+			config.defaults = source.Defaults
+		}
+	}
+	if topLevel > 1 {
+		// Defaults of each file only apply to its own repositories.
+		config.defaults = synchronizer.RepositoryPair{}
+	}
+	return config, nil
+}
+
+// loadConfigFiles sets repositories, notifiers and default settings from all configuration files.
+func loadConfigFiles(pattern string) error {
+	config, err := readConfig(pattern)
+	if err != nil {
+		return err
+	}
+	inputRepositories, notifiers, defaultSettings = config.repositories, config.notifiers, config.defaults
+	return nil
+}
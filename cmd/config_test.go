@@ -0,0 +1,240 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/insightsengineering/git-synchronizer/synchronizer"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeConfigFiles writes files with the given contents, keyed by path relative to a temporary directory,
+// and returns the directory.
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	directory := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(directory, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+	return directory
+}
+
+func Test_loadConfigFiles(t *testing.T) {
+	directory := writeConfigFiles(t, map[string]string{
+		"main.yml": `defaults:
+  source:
+    auth:
+      method: token
+      token_name: GITHUB_TOKEN
+include:
+  - teams
+repositories:
+  - source:
+      repo: https://github.example.com/org-1/repo-1
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-1
+`,
+		"teams/team-a.yaml": `defaults:
+  destination:
+    auth:
+      method: token
+      token_name: TEAM_A_TOKEN
+repositories:
+  - source:
+      repo: https://github.example.com/team-a/repo-2
+    destination:
+      repo: https://gitlab.example.com/team-a/repo-2
+`,
+		"teams/team-b.yml": `repositories:
+  - source:
+      repo: https://github.example.com/team-b/repo-3
+    destination:
+      repo: https://gitlab.example.com/team-b/repo-3
+notifications:
+  - type: webhook
+    url: https://hooks.example.com/team-b
+`,
+	})
+	assert.NoError(t, loadConfigFiles(filepath.Join(directory, "main.yml")))
+	assert.Len(t, inputRepositories, 3)
+	githubToken := synchronizer.Authentication{Method: synchronizer.AuthMethodToken, TokenName: "GITHUB_TOKEN"}
+	teamAToken := synchronizer.Authentication{Method: synchronizer.AuthMethodToken, TokenName: "TEAM_A_TOKEN"}
+	for _, repository := range inputRepositories {
+		// Defaults of the main file are inherited by the included files.
+		assert.Equal(t, githubToken, repository.Source.Auth, repository.Source.RepositoryURL)
+	}
+	assert.Equal(t, synchronizer.Authentication{}, inputRepositories[0].Destination.Auth)
+	assert.Equal(t, teamAToken, inputRepositories[1].Destination.Auth)
+	assert.Equal(t, synchronizer.Authentication{}, inputRepositories[2].Destination.Auth)
+	assert.Len(t, notifiers, 1)
+	assert.Equal(t, githubToken, defaultSettings.Source.Auth)
+
+	// Defaults of files matched by a glob only apply to their own repositories.
+	assert.NoError(t, loadConfigFiles(filepath.Join(directory, "teams", "*")))
+	assert.Len(t, inputRepositories, 2)
+	assert.Equal(t, teamAToken, inputRepositories[0].Destination.Auth)
+	assert.Equal(t, synchronizer.Authentication{}, inputRepositories[1].Destination.Auth)
+	assert.Equal(t, synchronizer.RepositoryPair{}, defaultSettings)
+}
+
+func Test_loadConfigFilesIncludedFromDirectory(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "github-token")
+	// Files in the directory which are included by another one are read as included files, whatever their names.
+	for _, team := range []string{"a-team.yml", "z-team.yml"} {
+		directory := writeConfigFiles(t, map[string]string{
+			"main.yml": `defaults:
+  source:
+    auth:
+      method: token
+      token_name: GITHUB_TOKEN
+include:
+  - ` + team + `
+repositories:
+  - source:
+      repo: https://github.example.com/org-1/repo-1
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-1
+`,
+			team: `repositories:
+  - source:
+      repo: https://github.example.com/team-a/repo-2
+    destination:
+      repo: https://gitlab.example.com/team-a/repo-2
+`,
+		})
+		assert.Empty(t, ValidateConfigFiles(directory), team)
+		assert.NoError(t, loadConfigFiles(directory), team)
+		assert.Len(t, inputRepositories, 2, team)
+		githubToken := synchronizer.Authentication{Method: synchronizer.AuthMethodToken, TokenName: "GITHUB_TOKEN"}
+		for _, repository := range inputRepositories {
+			assert.Equal(t, githubToken, repository.Source.Auth, team)
+		}
+		assert.Equal(t, githubToken, defaultSettings.Source.Auth, team)
+	}
+}
+
+func Test_ValidateConfigFiles(t *testing.T) {
+	t.Setenv("GITLAB_TOKEN", "gitlab-token")
+	directory := writeConfigFiles(t, map[string]string{
+		"a.yml": `include:
+  - missing.yml
+  - b.yml
+repositories:
+  - source:
+      repo: https://github.example.com/org-1/repo-1
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-1
+`,
+		"b.yml": `defaults:
+  destination:
+    auth:
+      method: token
+      token_name: GITLAB_TOKEN
+include:
+  - a.yml
+repositories:
+  - source:
+      repo: https://github.example.com/org-1/repo-2
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-1
+`,
+		"c.yaml": `repositories:
+  - source:
+      repo: https://github.example.com/org-1/repo-3
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-3
+    unprotect_branches: true
+`,
+	})
+	a, b, c := filepath.Join(directory, "a.yml"), filepath.Join(directory, "b.yml"), filepath.Join(directory, "c.yaml")
+	assert.Equal(t, []ConfigFileProblem{
+		{a, ConfigProblem{2, "stat " + filepath.Join(directory, "missing.yml") + ": no such file or directory"}},
+		{b, ConfigProblem{7, a + " is included more than once"}},
+		{b, ConfigProblem{12, "destination https://gitlab.example.com/org-5/repo-1 is already used by the " +
+			"repository on line 8 of " + a}},
+		{c, ConfigProblem{6, "unprotect_branches requires token authentication for destination repository " +
+			"https://gitlab.example.com/org-5/repo-3"}},
+	}, ValidateConfigFiles(directory))
+	assert.Equal(t, "no configuration files found in "+filepath.Join(directory, "*.json"),
+		ValidateConfigFiles(filepath.Join(directory, "*.json"))[0].Message)
+}
+
+func Test_ValidateConfigFilesVariables(t *testing.T) {
+	t.Setenv("GITLAB_HOST", "gitlab.example.com")
+	directory := writeConfigFiles(t, map[string]string{
+		"main.yml": `variables:
+  org: org-5
+defaults:
+  source_base: https://github.example.com/org-1/{{.Name}}
+  destination_base: https://${GITLAB_HOST}/${org}/{{.Name}}
+include:
+  - team.yml
+repositories:
+  - name: repo-1
+  - name: repo-2
+    destination:
+      repo: https://${GITLAB_HOST}/archive/repo-2
+`,
+		"team.yml": `repositories:
+  - name: repo-3
+    source_base: https://github.example.com/${team}/{{.Name}}
+  - name: repo-4
+    destination_base: https://gitlab.example.com/{{.Org}}/{{.Name}}
+`,
+	})
+	main, team := filepath.Join(directory, "main.yml"), filepath.Join(directory, "team.yml")
+	assert.Equal(t, []ConfigFileProblem{
+		{team, ConfigProblem{3, "variable team is not defined"}},
+		{team, ConfigProblem{4, "cannot expand destination URL template of repository repo-4: template: url:1:29: " +
+			`executing "url" at <.Org>: can't evaluate field Org in type synchronizer.urlTemplateData`}},
+		{team, ConfigProblem{4, "destination repository URL is empty"}},
+	}, ValidateConfigFiles(main))
+
+	assert.Error(t, loadConfigFiles(main))
+	assert.NoError(t, os.WriteFile(team, []byte("variables:\n  team: team-a\n"), 0600))
+	assert.NoError(t, loadConfigFiles(main))
+	assert.Len(t, inputRepositories, 2)
+	assert.Equal(t, "https://github.example.com/org-1/repo-1", inputRepositories[0].Source.RepositoryURL)
+	assert.Equal(t, "https://gitlab.example.com/org-5/repo-1", inputRepositories[0].Destination.RepositoryURL)
+	assert.Equal(t, "https://gitlab.example.com/archive/repo-2", inputRepositories[1].Destination.RepositoryURL)
+}
+
+func Test_loadConfigFilesVariablesInValues(t *testing.T) {
+	// Values are substituted after parsing, so they may contain YAML syntax.
+	t.Setenv("GITLAB_TOKEN_NAME", "GITLAB: TOKEN # 1\nrepositories: []")
+	directory := writeConfigFiles(t, map[string]string{
+		"main.yml": `# The old host was ${OLD_HOST}.
+defaults:
+  destination:
+    auth:
+      method: token
+      token_name: ${GITLAB_TOKEN_NAME}
+repositories:
+  - source:
+      repo: https://github.example.com/org-1/repo-1 # ${OLD_HOST}
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-1
+`,
+	})
+	assert.NoError(t, loadConfigFiles(directory))
+	assert.Len(t, inputRepositories, 1)
+	assert.Equal(t, "GITLAB: TOKEN # 1\nrepositories: []", inputRepositories[0].Destination.Auth.TokenName)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/insightsengineering/git-synchronizer/synchronizer"
+)
+
+// Exit codes of git-synchronizer.
+const (
+	exitCodeSuccess = 0
+	// Synchronization of every repository failed, or synchronization could not be started.
+	exitCodeTotalFailure = 1
+	// The configuration file is invalid.
+	exitCodeConfigError = 2
+	// Synchronization of some of the repositories failed.
+	exitCodePartialFailure = 3
+)
+
+// Kinds of errors which cause non-zero exit code.
+var failOn []string
+
+func kindNames(kinds []synchronizer.ErrorKind) []string {
+	var names []string
+	for _, kind := range kinds {
+		names = append(names, string(kind))
+	}
+	return names
+}
+
+// validateFailOn checks that failOn contains only known error kinds.
+func validateFailOn(failOn []string) error {
+	for _, kind := range failOn {
+		if !slices.Contains(synchronizer.ErrorKinds, synchronizer.ErrorKind(kind)) {
+			return errors.New("unknown error kind " + kind + " in --failOn")
+		}
+	}
+	return nil
+}
+
+// failed returns true if synchronization of the repository pair has been cancelled,
+// or has encountered an error whose kind is listed in failOn.
+func failed(status synchronizer.MirrorStatus, failOn []string) bool {
+	if status.Cancelled {
+		return true
+	}
+	for _, e := range status.Errors {
+		if slices.Contains(failOn, string(e.Kind)) {
+			return true
+		}
+	}
+	return false
+}
+
+// exitCode returns exit code summarizing result. Only errors whose kind is listed in failOn are considered.
+func exitCode(result synchronizer.Result, failOn []string) int {
+	failedRepositories := 0
+	for _, status := range result.Repositories {
+		if failed(status, failOn) {
+			failedRepositories++
+		}
+	}
+	switch failedRepositories {
+	case 0:
+		return exitCodeSuccess
+	case len(result.Repositories):
+		return exitCodeTotalFailure
+	default:
+		return exitCodePartialFailure
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/insightsengineering/git-synchronizer/synchronizer"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_exitCode(t *testing.T) {
+	networkError := []synchronizer.SyncError{{Kind: synchronizer.ErrorNetwork}}
+	authError := []synchronizer.SyncError{{Kind: synchronizer.ErrorAuth}}
+	all := kindNames(synchronizer.ErrorKinds)
+	result := synchronizer.Result{Repositories: []synchronizer.MirrorStatus{
+		{Source: "a"}, {Source: "b", Errors: networkError},
+	}}
+	assert.Equal(t, exitCodePartialFailure, exitCode(result, all))
+	assert.Equal(t, exitCodeSuccess, exitCode(result, []string{"auth"}))
+
+	result.Repositories[0].Errors = authError
+	assert.Equal(t, exitCodeTotalFailure, exitCode(result, all))
+	assert.Equal(t, exitCodePartialFailure, exitCode(result, []string{"auth"}))
+
+	result.Repositories[0] = synchronizer.MirrorStatus{Source: "a", Cancelled: true}
+	assert.Equal(t, exitCodePartialFailure, exitCode(result, []string{"auth"}))
+
+	assert.NoError(t, validateFailOn([]string{"auth", "protected-branch"}))
+	assert.EqualError(t, validateFailOn([]string{"timeout"}), "unknown error kind timeout in --failOn")
+}
+
+func Test_logResult(t *testing.T) {
+	hook := logtest.NewLocal(log)
+	defer log.ReplaceHooks(make(logrus.LevelHooks))
+	logResult(synchronizer.Result{Repositories: []synchronizer.MirrorStatus{
+		{Source: "a", Destination: "b", Cancelled: true,
+			Errors: []synchronizer.SyncError{{Kind: synchronizer.ErrorAuth, Message: "authentication required"}}},
+		{Source: "c", Destination: "d", Errors: []synchronizer.SyncError{{Kind: synchronizer.ErrorOther, Message: "failed"}}},
+	}})
+	var messages []string
+	for _, entry := range hook.AllEntries() {
+		messages = append(messages, entry.Message)
+	}
+	assert.Equal(t, []string{
+		"Synchronization of the following repositories has been cancelled:", "a → b", "  authentication required",
+		"The following errors have been encountered:", "failed",
+	}, messages)
+}
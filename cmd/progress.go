@@ -0,0 +1,219 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/insightsengineering/git-synchronizer/synchronizer"
+)
+
+const progressRefreshInterval = 200 * time.Millisecond
+
+// Maximum number of in-flight repositories listed in the progress view.
+const progressMaxLines = 20
+
+type progressEntry struct {
+	source      string
+	destination string
+	phase       string
+	done        int
+	total       int
+	transfer    string
+}
+
+// terminalProgress renders repositories being synchronized in a terminal. Log messages written to it
+// are printed above the progress view.
+type terminalProgress struct {
+	mu       sync.Mutex
+	out      io.Writer
+	total    int
+	inFlight []*progressEntry
+	finished []synchronizer.MirrorStatus
+	// Number of lines rendered last time, which are cleared before rendering again.
+	lines int
+	// Returns the current width of the terminal, or 0 if it is unknown.
+	width func() int
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func newTerminalProgress(out io.Writer, total int, width func() int) *terminalProgress {
+	return &terminalProgress{out: out, total: total, width: width}
+}
+
+// start refreshes the progress view periodically until Close is called.
+func (p *terminalProgress) start() {
+	p.stop, p.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(progressRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.mu.Lock()
+				p.render()
+				p.mu.Unlock()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// entry returns in-flight repository pair, adding it if necessary. Must be called with mu locked.
+func (p *terminalProgress) entry(source, destination string) *progressEntry {
+	for _, e := range p.inFlight {
+		if e.source == source && e.destination == destination {
+			return e
+		}
+	}
+	e := &progressEntry{source: source, destination: destination}
+	p.inFlight = append(p.inFlight, e)
+	return e
+}
+
+func (p *terminalProgress) Phase(source, destination, phase string, done, total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e := p.entry(source, destination)
+	if e.phase != phase {
+		e.transfer = ""
+	}
+	e.phase, e.done, e.total = phase, done, total
+}
+
+func (p *terminalProgress) Transfer(source, destination, message string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entry(source, destination).transfer = message
+}
+
+func (p *terminalProgress) Finished(status synchronizer.MirrorStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, e := range p.inFlight {
+		if e.source == status.Source && e.destination == status.Destination {
+			p.inFlight = append(p.inFlight[:i], p.inFlight[i+1:]...)
+			break
+		}
+	}
+	p.finished = append(p.finished, status)
+}
+
+// Write prints log messages above the progress view.
+func (p *terminalProgress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	n, err := p.out.Write(b)
+	p.render()
+	return n, err
+}
+
+// clear removes the progress view from the terminal. Must be called with mu locked.
+func (p *terminalProgress) clear() {
+	if p.lines > 0 {
+		fmt.Fprintf(p.out, "\x1b[%dA\x1b[J", p.lines)
+		p.lines = 0
+	}
+}
+
+// render redraws the progress view. Must be called with mu locked.
+func (p *terminalProgress) render() {
+	p.clear()
+	width := p.width()
+	var b strings.Builder
+	b.WriteString(truncateLine(fmt.Sprintf("Mirrored %d out of %d repositories, %d in progress.",
+		len(p.finished), p.total, len(p.inFlight)), width) + "\n")
+	for i, e := range p.inFlight {
+		if i == progressMaxLines {
+			fmt.Fprintf(&b, "  ... and %d more\n", len(p.inFlight)-progressMaxLines)
+			break
+		}
+		line := "  " + e.source + " → " + e.destination + "  " + e.phase
+		if e.total > 0 {
+			line += " " + strconv.Itoa(e.done) + "/" + strconv.Itoa(e.total)
+		}
+		if e.transfer != "" {
+			line += "  " + e.transfer
+		}
+		b.WriteString(truncateLine(line, width) + "\n")
+	}
+	p.lines = strings.Count(b.String(), "\n")
+	fmt.Fprint(p.out, b.String())
+}
+
+// truncateLine shortens line to width characters, so that it is not wrapped by the terminal and occupies
+// a single line of the progress view. Lines are not truncated if width is not positive.
+func truncateLine(line string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(line) <= width {
+		return line
+	}
+	return string([]rune(line)[:width-1]) + "…"
+}
+
+// Close stops refreshing the progress view and replaces it with a summary table.
+func (p *terminalProgress) Close() error {
+	if p.stop != nil {
+		close(p.stop)
+		<-p.done
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	w := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tDESTINATION\tRESULT\tCLONE\tPUSH\tPRESERVED\tTAGS")
+	for _, status := range p.finished {
+		fmt.Fprintln(w, status.Source+"\t"+status.Destination+"\t"+mirrorResult(status)+"\t"+
+			status.CloneDuration.Round(time.Second).String()+"\t"+status.PushDuration.Round(time.Second).String()+"\t"+
+			strconv.Itoa(len(status.PreservedRefs))+"\t"+tagSummary(status.Tags))
+	}
+	return w.Flush()
+}
+
+// mirrorResult returns short description of the outcome of repository pair synchronization.
+func mirrorResult(status synchronizer.MirrorStatus) string {
+	switch {
+	case status.Cancelled:
+		return "cancelled"
+	case len(status.Errors) > 0:
+		return "failed (" + strconv.Itoa(len(status.Errors)) + " errors)"
+	case status.Skipped:
+		return "unchanged"
+	default:
+		return "ok"
+	}
+}
+
+// tagSummary returns numbers of annotated and lightweight tags.
+func tagSummary(tags []synchronizer.TagStatus) string {
+	annotated := 0
+	for _, tag := range tags {
+		if tag.Annotated {
+			annotated++
+		}
+	}
+	return strconv.Itoa(annotated) + " annotated, " + strconv.Itoa(len(tags)-annotated) + " lightweight"
+}
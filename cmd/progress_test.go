@@ -0,0 +1,64 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/insightsengineering/git-synchronizer/synchronizer"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_terminalProgress(t *testing.T) {
+	var out bytes.Buffer
+	width := 0
+	p := newTerminalProgress(&out, 2, func() int { return width })
+	p.Phase("a", "b", synchronizer.PhasePushingBranches, 1, 3)
+	p.Transfer("a", "b", "Counting objects: 50% (1/2)")
+	p.Phase("c", "d", synchronizer.PhaseCloning, 0, 0)
+	p.mu.Lock()
+	p.render()
+	p.mu.Unlock()
+	assert.Equal(t, "Mirrored 0 out of 2 repositories, 2 in progress.\n"+
+		"  a → b  pushing branches 1/3  Counting objects: 50% (1/2)\n"+
+		"  c → d  cloning\n", out.String())
+
+	// Lines wider than the terminal are truncated, so that each of them is cleared before rendering again.
+	out.Reset()
+	width = 20
+	p.mu.Lock()
+	p.render()
+	p.mu.Unlock()
+	assert.Equal(t, "\x1b[3A\x1b[J"+
+		"Mirrored 0 out of 2…\n"+
+		"  a → b  pushing br…\n"+
+		"  c → d  cloning\n", out.String())
+
+	out.Reset()
+	p.Finished(synchronizer.MirrorStatus{
+		Source: "a", Destination: "b", Errors: []synchronizer.SyncError{{Message: "push failed"}},
+	})
+	p.Finished(synchronizer.MirrorStatus{Source: "c", Destination: "d", Skipped: true, Tags: []synchronizer.TagStatus{
+		{Name: "v1.0", Annotated: true}, {Name: "v1.1"}, {Name: "v1.2", Annotated: true},
+	}})
+	assert.NoError(t, p.Close())
+	assert.Equal(t, "\x1b[3A\x1b[J"+
+		"SOURCE  DESTINATION  RESULT             CLONE  PUSH  PRESERVED  TAGS\n"+
+		"a       b            failed (1 errors)  0s     0s    0          0 annotated, 0 lightweight\n"+
+		"c       d            unchanged          0s     0s    0          2 annotated, 1 lightweight\n", out.String())
+}
@@ -16,53 +16,70 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/insightsengineering/git-synchronizer/synchronizer"
 	"github.com/jamiealquiza/envy"
+	"github.com/mattn/go-isatty"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.szostok.io/version/extension"
+	"golang.org/x/term"
 )
 
 var cfgFile string
 var logLevel string
+var logFormat string
 var workingDirectory string
+var gracePeriod time.Duration
+var fullSyncInterval time.Duration
+var showProgress bool
 
-type RepositoryPair struct {
-	Source      Repository `mapstructure:"source"`
-	Destination Repository `mapstructure:"destination"`
-}
+// Criteria selecting repositories to be synchronized, from command line flags and arguments.
+var repositoryFilter synchronizer.RepositoryFilter
 
-type Repository struct {
-	RepositoryURL string         `mapstructure:"repo"`
-	Auth          Authentication `mapstructure:"auth"`
-}
+// Repository list provided in YAML configuration file.
+var inputRepositories []synchronizer.RepositoryPair
+var defaultSettings synchronizer.RepositoryPair
 
-type Authentication struct {
-	Method    string `mapstructure:"method"`
-	TokenName string `mapstructure:"token_name"`
-}
+// Notifiers provided in YAML configuration file.
+var notifiers []synchronizer.NotifierConfig
 
-// Repository list provided in YAML configuration file.
-var inputRepositories []RepositoryPair
-var defaultSettings RepositoryPair
+// Configuration files read by initConfig and errors encountered while reading them. They are logged
+// by setLogLevel, once the log format is known.
+var configFilesUsed []string
+var configFileErrors []error
 
-var localTempDirectory string
+// logFormats lists supported values of the logFormat setting.
+var logFormats = []string{"text", "json"}
 
 var log = logrus.New()
 
 func setLogLevel() {
-	customFormatter := new(logrus.TextFormatter)
-	customFormatter.TimestampFormat = "2006-01-02 15:04:05"
-	customFormatter.ForceColors = true
-	log.SetFormatter(customFormatter)
+	switch logFormat {
+	case "json":
+		log.SetFormatter(&logrus.JSONFormatter{TimestampFormat: "2006-01-02 15:04:05"})
+	case "text":
+		// Colors are only used when logging to a terminal.
+		customFormatter := new(logrus.TextFormatter)
+		customFormatter.TimestampFormat = "2006-01-02 15:04:05"
+		customFormatter.FullTimestamp = false
+		log.SetFormatter(customFormatter)
+	default:
+		log.Error("Unknown log format ", logFormat, ", supported formats are: ", strings.Join(logFormats, ", "), ".")
+		os.Exit(exitCodeConfigError)
+	}
 	log.SetReportCaller(false)
-	customFormatter.FullTimestamp = false
-	fmt.Println(`logLevel = "` + logLevel + `"`)
 	switch logLevel {
 	case "trace":
 		log.SetLevel(logrus.TraceLevel)
@@ -77,22 +94,179 @@ func setLogLevel() {
 	default:
 		log.SetLevel(logrus.InfoLevel)
 	}
+	log.Debug(`logLevel = "` + logLevel + `"`)
+	for _, file := range configFilesUsed {
+		log.Debug("Using config file: ", file)
+	}
+	for _, err := range configFileErrors {
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) {
+			// Running without a configuration file is allowed, e.g. for the sync command.
+			log.Debug(err)
+		} else {
+			log.Warn(err)
+		}
+	}
+}
+
+// notificationRules returns the notification rules of notifiers, skipping the invalid ones.
+func notificationRules(notifiers []synchronizer.NotifierConfig) []synchronizer.NotificationRule {
+	var rules []synchronizer.NotificationRule
+	for _, notifier := range notifiers {
+		rule, err := synchronizer.NewNotificationRule(notifier)
+		if err != nil {
+			log.Error("Skipping notifier: ", err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// newSyncer returns synchronizer configured according to command line flags and opts.
+func newSyncer(opts ...synchronizer.Option) *synchronizer.Syncer {
+	localTempDirectory := workingDirectory
+	if runtime.GOOS == "windows" {
+		localTempDirectory = os.Getenv("TMP") + workingDirectory
+	}
+	return synchronizer.New(append([]synchronizer.Option{
+		synchronizer.WithWorkingDirectory(localTempDirectory),
+		synchronizer.WithGracePeriod(gracePeriod),
+		synchronizer.WithFullSyncInterval(fullSyncInterval),
+		synchronizer.WithLogger(log),
+		synchronizer.WithNotifications(notificationRules(notifiers)...),
+	}, opts...)...)
+}
+
+// resolveRepositories applies default settings from config file to the repositories,
+// checks them for common issues and returns the ones selected by repositoryFilter.
+func resolveRepositories(repositories []synchronizer.RepositoryPair,
+	defaults synchronizer.RepositoryPair) ([]synchronizer.RepositoryPair, error) {
+	if err := synchronizer.SetRepositoryURLs(&repositories, defaults); err != nil {
+		return nil, err
+	}
+	synchronizer.SetRepositoryAuth(&repositories, defaults)
+	synchronizer.SetRepositoryRetryPolicy(&repositories, defaults)
+	synchronizer.SetRepositoryRefPolicy(&repositories, defaults)
+	synchronizer.SetRepositorySignaturePolicy(&repositories, defaults)
+	synchronizer.SetRepositoryLabels(&repositories, defaults)
+	synchronizer.SetRepositoryConnectionSettings(&repositories, defaults)
+	repositoriesJSON, err := json.MarshalIndent(repositories, "", "  ")
+	checkError(err)
+	log.Trace("repositories = ", string(repositoriesJSON))
+	if err = newSyncer().ValidateRepositories(repositories); err != nil {
+		return nil, err
+	}
+	if repositories, err = repositoryFilter.Apply(repositories); err != nil {
+		return nil, err
+	}
+	warnInsecureRepositories(repositories)
+	return repositories, nil
+}
+
+// warnInsecureRepositories logs a warning for every repository whose server certificates are not verified.
+func warnInsecureRepositories(repositories []synchronizer.RepositoryPair) {
+	for _, repositoryPair := range repositories {
+		for _, repository := range []synchronizer.Repository{repositoryPair.Source, repositoryPair.Destination} {
+			if repository.TLS.SkipVerify() {
+				log.Warn("Certificates of ", repository.RepositoryURL, " are not verified, as insecure_skip_verify ",
+					"is set. This should only be used for testing.")
+			}
+		}
+	}
+}
+
+// prepareRepositories returns the repositories from config file which are to be processed,
+// exiting if they are invalid.
+func prepareRepositories() []synchronizer.RepositoryPair {
+	repositories, err := resolveRepositories(inputRepositories, defaultSettings)
+	if err != nil {
+		log.Error(err)
+		os.Exit(exitCodeConfigError)
+	}
+	return repositories
+}
+
+// logResult lists repositories whose synchronization has been cancelled, together with errors encountered
+// before cancellation, and all errors encountered while synchronizing the other repositories.
+func logResult(result synchronizer.Result) {
+	if cancelled := result.Cancelled(); len(cancelled) > 0 {
+		log.Warn("Synchronization of the following repositories has been cancelled:")
+		for _, r := range cancelled {
+			log.Warn(r.Source, " → ", r.Destination)
+			for _, e := range r.Errors {
+				log.WithField("kind", e.Kind).Error("  ", e)
+			}
+		}
+	}
+	if allErrors := result.Errors(); len(allErrors) > 0 {
+		log.Error("The following errors have been encountered:")
+		for _, e := range allErrors {
+			log.WithField("kind", e.Kind).Error(e)
+		}
+	}
+}
+
+// reportResult logs errors returned by Syncer and exits with the exit code resulting from failOn.
+func reportResult(result synchronizer.Result, err error, failOn []string) {
+	if err == nil {
+		return
+	}
+	if len(result.Repositories) == 0 {
+		log.Fatal(err)
+	}
+	logResult(result)
+	if code := exitCode(result, failOn); code != exitCodeSuccess {
+		log.Error(err)
+		os.Exit(code)
+	}
+	log.Warn(err, ", but none of the errors is listed in --failOn.")
+}
+
+// mirror synchronizes repositories with synchronizer configured by opts, showing the progress view
+// if it has been requested.
+func mirror(ctx context.Context, repositories []synchronizer.RepositoryPair,
+	opts ...synchronizer.Option) (synchronizer.Result, error) {
+	if !showProgress {
+		return newSyncer(opts...).Mirror(ctx, repositories)
+	}
+	if !isatty.IsTerminal(os.Stderr.Fd()) && !isatty.IsCygwinTerminal(os.Stderr.Fd()) {
+		log.Warn("Progress view requires a terminal, ignoring --progress.")
+		return newSyncer(opts...).Mirror(ctx, repositories)
+	}
+	progress := newTerminalProgress(os.Stderr, len(repositories), func() int {
+		width, _, err := term.GetSize(int(os.Stderr.Fd()))
+		if err != nil {
+			return 0
+		}
+		return width
+	})
+	progress.start()
+	log.SetOutput(progress)
+	defer log.SetOutput(os.Stderr)
+	defer func() { checkError(progress.Close()) }()
+	return newSyncer(append(opts, synchronizer.WithProgress(progress))...).Mirror(ctx, repositories)
 }
 
 var rootCmd *cobra.Command
 
 func newRootCommand() {
 	rootCmd = &cobra.Command{
-		Use:   "git-synchronizer",
+		Use:   "git-synchronizer [repository...]",
 		Short: "A tool to synchronize git repositories.",
-		Long:  `A tool to synchronize git repositories from one git server to another.`,
+		Long: `A tool to synchronize git repositories from one git server to another.
+If repositories are given, only the ones with these names, or whose source or destination URLs
+end with these names, are synchronized.`,
+		Args: cobra.ArbitraryArgs,
 		PersistentPreRun: func(_ *cobra.Command, _ []string) {
 			initializeConfig()
+			if err := validateFailOn(failOn); err != nil {
+				log.Error(err)
+				os.Exit(exitCodeConfigError)
+			}
 		},
-		Run: func(_ *cobra.Command, _ []string) {
-			setLogLevel()
-
-			fmt.Println(`config = "` + cfgFile + `"`)
+		Run: func(cmd *cobra.Command, args []string) {
+			log.Debug(`config = "` + cfgFile + `"`)
 			inputRepositoriesJSON, err := json.MarshalIndent(inputRepositories, "", "  ")
 			checkError(err)
 			defaultSettingsJSON, err := json.MarshalIndent(defaultSettings, "", "  ")
@@ -100,30 +274,55 @@ func newRootCommand() {
 			log.Trace("inputRepositories = ", string(inputRepositoriesJSON))
 			log.Trace("defaultSettings = ", string(defaultSettingsJSON))
 
-			if runtime.GOOS == "windows" {
-				localTempDirectory = os.Getenv("TMP") + workingDirectory
-			} else {
-				localTempDirectory = workingDirectory
+			validateConfiguration()
+			repositoryFilter.Names = args
+			repositories := prepareRepositories()
+			if syncInterval > 0 {
+				synchronizePeriodically(cmd.Context(), repositories)
+				return
 			}
 
-			SetRepositoryAuth(&inputRepositories, defaultSettings)
-			ValidateRepositories(inputRepositories)
-
-			err = os.MkdirAll(localTempDirectory, os.ModePerm)
-			checkError(err)
-
-			MirrorRepositories(inputRepositories)
+			result, err := mirror(cmd.Context(), repositories)
+			reportResult(result, err, failOn)
 		},
 	}
+	rootCmd.PersistentFlags().StringSliceVar(&failOn, "failOn", kindNames(synchronizer.ErrorKinds),
+		"Kinds of errors which cause non-zero exit code (auth, not-found, network, rejected-push, "+
+			"protected-branch, deletion-blocked, moved-tag, unverified-signature, other).")
+	rootCmd.Flags().DurationVar(&syncInterval, "interval", 0,
+		"Synchronize repositories repeatedly with this interval, reloading configuration files when they change. "+
+			"By default, repositories are synchronized once.")
+	rootCmd.Flags().BoolVar(&showProgress, "progress", false,
+		"Show repositories being synchronized and a summary table when running in a terminal.")
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "",
-		"config file (default is $HOME/.git-synchronizer.yaml)")
+		"config file, directory with config files or glob matching them (default is $HOME/.git-synchronizer.yaml)")
 	rootCmd.PersistentFlags().StringVarP(&logLevel, "logLevel", "l", "info",
 		"Logging level (trace, debug, info, warn, error). ")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "logFormat", "text",
+		"Logging format (text, json).")
 	rootCmd.PersistentFlags().StringVarP(&workingDirectory, "workingDirectory", "w", "/tmp/git-synchronizer",
 		"Directory where synchronized repositories will be cloned.")
+	rootCmd.PersistentFlags().DurationVar(&gracePeriod, "gracePeriod", 30*time.Second,
+		"Time given to operations in progress to complete after an interrupt signal has been received.")
+	rootCmd.PersistentFlags().DurationVar(&fullSyncInterval, "fullSyncInterval", 24*time.Hour,
+		"Maximum time between full synchronizations of repositories whose source has not changed. "+
+			"Set to 0 to synchronize all repositories in every run.")
+	rootCmd.PersistentFlags().StringSliceVar(&repositoryFilter.Only, "only", nil,
+		"Only process repositories whose source or destination URL matches any of the patterns (* matches any text).")
+	rootCmd.PersistentFlags().StringSliceVar(&repositoryFilter.Exclude, "exclude", nil,
+		"Skip repositories whose source or destination URL matches any of the patterns (* matches any text).")
+	rootCmd.PersistentFlags().StringSliceVar(&repositoryFilter.Labels, "label", nil,
+		"Only process repositories having any of the labels.")
 
 	// Add version command.
 	rootCmd.AddCommand(extension.NewVersionCobraCmd())
+	rootCmd.AddCommand(newValidateCommand())
+	rootCmd.AddCommand(newCheckCommand())
+	rootCmd.AddCommand(newStatusCommand())
+	rootCmd.AddCommand(newBundleCommand())
+	rootCmd.AddCommand(newBackupCommand())
+	rootCmd.AddCommand(newRestoreCommand())
+	rootCmd.AddCommand(newSyncCommand())
 
 	cfg := envy.CobraConfig{
 		Prefix:     "GITSYNCHRONIZER",
@@ -137,9 +336,15 @@ func init() {
 }
 
 func initConfig() {
+	var files []string
 	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
+		// Use config files from the flag.
+		var err error
+		if files, err = configFiles(cfgFile); err != nil {
+			configFileErrors = append(configFileErrors, err)
+			return
+		}
+		viper.SetConfigFile(files[0])
 	} else {
 		// Find home directory.
 		home, err := os.UserHomeDir()
@@ -155,22 +360,44 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+		configFilesUsed = append(configFilesUsed, viper.ConfigFileUsed())
 	} else {
-		fmt.Println(err)
+		configFileErrors = append(configFileErrors, err)
+	}
+	// Settings from multiple config files are merged, later files taking precedence.
+	for i := 1; i < len(files); i++ {
+		viper.SetConfigFile(files[i])
+		if err := viper.MergeInConfig(); err == nil {
+			configFilesUsed = append(configFilesUsed, files[i])
+		} else {
+			configFileErrors = append(configFileErrors, err)
+		}
 	}
 }
 
 func Execute() {
 	newRootCommand()
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Warn("Shutting down, operations in progress have ", gracePeriod, " to complete. ",
+			"Interrupt again to exit immediately.")
+		// Restore default behavior, so that next signal terminates the program.
+		signal.Stop(signals)
+		cancel()
+	}()
+	// Errors returned by cobra are caused by unknown commands, invalid flags or arguments.
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		os.Exit(exitCodeConfigError)
 	}
 }
 
 func initializeConfig() {
 	for _, v := range []string{
-		"logLevel", "workingDirectory",
+		"logLevel", "logFormat", "workingDirectory", "gracePeriod", "fullSyncInterval",
 	} {
 		// If the flag has not been set in newRootCommand() and it has been set in initConfig().
 		// In other words: if it's not been provided in command line, but has been
@@ -183,10 +410,10 @@ func initializeConfig() {
 		}
 	}
 
-	// Check if a YAML list of input git repositories has been provided in the configuration file.
-	err := viper.UnmarshalKey("repositories", &inputRepositories)
-	checkError(err)
-	// Read default settings from configuration file.
-	err = viper.UnmarshalKey("defaults", &defaultSettings)
-	checkError(err)
+	setLogLevel()
+
+	// Read repositories, default settings and notifiers from the configuration files and the files they include.
+	if pattern := configPattern(); pattern != "" {
+		checkError(loadConfigFiles(pattern))
+	}
 }
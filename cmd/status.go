@@ -0,0 +1,89 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/insightsengineering/git-synchronizer/synchronizer"
+	"github.com/spf13/cobra"
+)
+
+const statusTimeFormat = "2006-01-02 15:04:05"
+
+func formatStatusTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Local().Format(statusTimeFormat)
+}
+
+// PrintState prints a table with the outcome of the last synchronization of each repository pair.
+func PrintState(out io.Writer, state synchronizer.State) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tDESTINATION\tLAST ATTEMPT\tLAST SUCCESS\tREFS\tLAST ERROR")
+	for _, r := range state.Repositories {
+		lastError := "-"
+		if r.Failed() {
+			lastError = r.LastErrors[0].Message
+			if len(r.LastErrors) > 1 {
+				lastError += " (+" + strconv.Itoa(len(r.LastErrors)-1) + " more)"
+			}
+		}
+		fmt.Fprintln(w, r.Source+"\t"+r.Destination+"\t"+formatStatusTime(r.LastAttempt)+"\t"+
+			formatStatusTime(r.LastSuccess)+"\t"+strconv.Itoa(len(r.Refs))+"\t"+lastError)
+	}
+	return w.Flush()
+}
+
+func newStatusCommand() *cobra.Command {
+	var output string
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the outcome of previous synchronizations.",
+		Long: `Print the last synchronization attempt, the last successful synchronization, the last errors
+and the number of refs pushed for each repository pair, as recorded in the working directory.`,
+		Run: func(_ *cobra.Command, _ []string) {
+			state, err := newSyncer().LoadState()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Cannot read synchronization state:", err)
+				os.Exit(1)
+			}
+			switch output {
+			case "json":
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				err = encoder.Encode(state)
+			case "table":
+				err = PrintState(os.Stdout, state)
+			default:
+				err = fmt.Errorf("unknown output format %s", output)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		},
+	}
+	statusCmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json.")
+	return statusCmd
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/insightsengineering/git-synchronizer/synchronizer"
+	"github.com/spf13/cobra"
+)
+
+// syncPair returns the repository pair given by the arguments and flags of the sync command,
+// with unset values taken from the default settings in the configuration file.
+func syncPair(source, destination string, flags synchronizer.RepositoryPair) synchronizer.RepositoryPair {
+	flags.Source.RepositoryURL = source
+	flags.Destination.RepositoryURL = destination
+	for _, repository := range []*synchronizer.Repository{&flags.Source, &flags.Destination} {
+		if repository.Auth.TokenName != "" {
+			repository.Auth.Method = synchronizer.AuthMethodToken
+		}
+	}
+	config := synchronizer.Config{Defaults: defaultSettings, Repositories: []synchronizer.RepositoryPair{flags}}
+	return config.Resolve()[0]
+}
+
+// validateSyncPair returns problems with the repository pair given to the sync command.
+func validateSyncPair(repositoryPair synchronizer.RepositoryPair) []ConfigProblem {
+	problems := validateRepository(repositoryPair.Source, "source", repositoryPair.Source.Transport, nil)
+	problems = append(problems, validateRepository(repositoryPair.Destination, "destination",
+		repositoryPair.Destination.Transport, nil)...)
+	return append(problems, validateRefPolicy(repositoryPair, nil)...)
+}
+
+func newSyncCommand() *cobra.Command {
+	var flags synchronizer.RepositoryPair
+	syncCmd := &cobra.Command{
+		Use:   "sync <source-url> <destination-url>",
+		Short: "Mirror a single repository given on the command line.",
+		Long: `Mirror the source repository to the destination repository without listing them in a configuration file.
+Settings not given with flags are taken from the defaults in the configuration file, if there is one.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			validateConfiguration()
+			repositoryPair := syncPair(args[0], args[1], flags)
+			problems := validateSyncPair(repositoryPair)
+			for _, p := range problems {
+				log.Error(p)
+			}
+			if len(problems) > 0 {
+				os.Exit(exitCodeConfigError)
+			}
+			repositories := []synchronizer.RepositoryPair{repositoryPair}
+			checkError(newSyncer().ValidateRepositories(repositories))
+			warnInsecureRepositories(repositories)
+			result, err := mirror(cmd.Context(), repositories)
+			reportResult(result, err, failOn)
+		},
+	}
+	syncCmd.Flags().StringVar(&flags.Source.Auth.TokenName, "sourceToken", "",
+		"Name of the environment variable with the token used to authenticate to the source repository.")
+	syncCmd.Flags().StringVar(&flags.Destination.Auth.TokenName, "destinationToken", "",
+		"Name of the environment variable with the token used to authenticate to the destination repository.")
+	syncCmd.Flags().StringVar(&flags.Source.Transport, "sourceTransport", "",
+		"Transport used to access the source repository: go-git (default) or exec, which runs the git binary.")
+	syncCmd.Flags().StringVar(&flags.Destination.Transport, "destinationTransport", "",
+		"Transport used to access the destination repository: go-git (default) or exec, which runs the git binary.")
+	syncCmd.Flags().StringVar(&flags.Mode, "mode", "",
+		"Either mirror (default) or additive, in which case nothing is removed from the destination.")
+	syncCmd.Flags().StringSliceVar(&flags.Preserve, "preserve", nil,
+		"Patterns of branch and tag names which are never removed from the destination, e.g. internal/*.")
+	syncCmd.Flags().StringVar(&flags.TagPolicy, "tagPolicy", "",
+		"Handling of tags which have been moved in the source: force (default), immutable or skip.")
+	syncCmd.Flags().BoolVar(&flags.TagsOnly, "tagsOnly", false,
+		"Only synchronize tags, leaving branches in the destination untouched.")
+	syncCmd.Flags().BoolVar(&flags.UnprotectBranches, "unprotectBranches", false,
+		"Temporarily unprotect branches in the destination GitLab project when pushing to them is rejected.")
+	return syncCmd
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"testing"
+
+	"github.com/insightsengineering/git-synchronizer/synchronizer"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_syncPair(t *testing.T) {
+	defaultSettings = synchronizer.RepositoryPair{
+		Source:    synchronizer.Repository{Auth: synchronizer.Authentication{Method: "token", TokenName: "GITHUB_TOKEN"}},
+		Mode:      synchronizer.ModeAdditive,
+		TagPolicy: synchronizer.TagPolicyImmutable,
+	}
+	t.Cleanup(func() { defaultSettings = synchronizer.RepositoryPair{} })
+
+	repositoryPair := syncPair("https://github.example.com/org-1/repo-1", "https://gitlab.example.com/org-5/repo-1",
+		synchronizer.RepositoryPair{
+			Destination: synchronizer.Repository{Auth: synchronizer.Authentication{TokenName: "GITLAB_TOKEN"}},
+			TagPolicy:   synchronizer.TagPolicySkip,
+		})
+	assert.Equal(t, "https://github.example.com/org-1/repo-1", repositoryPair.Source.RepositoryURL)
+	assert.Equal(t, "https://gitlab.example.com/org-5/repo-1", repositoryPair.Destination.RepositoryURL)
+	assert.Equal(t, defaultSettings.Source.Auth, repositoryPair.Source.Auth)
+	assert.Equal(t, synchronizer.Authentication{Method: "token", TokenName: "GITLAB_TOKEN"},
+		repositoryPair.Destination.Auth)
+	assert.Equal(t, synchronizer.ModeAdditive, repositoryPair.Mode)
+	assert.Equal(t, synchronizer.TagPolicySkip, repositoryPair.TagPolicy)
+}
+
+func Test_validateSyncPair(t *testing.T) {
+	t.Setenv("GITLAB_TOKEN", "gitlab-token")
+	assert.Empty(t, validateSyncPair(syncPair("https://github.example.com/org-1/repo-1",
+		"https://gitlab.example.com/org-5/repo-1", synchronizer.RepositoryPair{
+			Destination: synchronizer.Repository{Auth: synchronizer.Authentication{TokenName: "GITLAB_TOKEN"}},
+		})))
+	assert.Equal(t, []ConfigProblem{
+		{0, "auth cannot be used with local source repository /srv/git/repo-1"},
+		{0, "unknown mode sync"},
+	}, validateSyncPair(syncPair("/srv/git/repo-1", "https://gitlab.example.com/org-5/repo-1",
+		synchronizer.RepositoryPair{
+			Source: synchronizer.Repository{Auth: synchronizer.Authentication{TokenName: "GITHUB_TOKEN"}},
+			Mode:   "sync",
+		})))
+}
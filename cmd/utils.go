@@ -24,12 +24,3 @@ func checkError(err error) {
 		log.Error(err)
 	}
 }
-
-func stringInSlice(a string, list []string) bool {
-	for _, b := range list {
-		if b == a {
-			return true
-		}
-	}
-	return false
-}
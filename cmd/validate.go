@@ -0,0 +1,524 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/insightsengineering/git-synchronizer/synchronizer"
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+// configFile describes all keys allowed in the configuration file.
+type configFile struct {
+	LogLevel         string                        `yaml:"logLevel"`
+	LogFormat        string                        `yaml:"logFormat"`
+	WorkingDirectory string                        `yaml:"workingDirectory"`
+	GracePeriod      time.Duration                 `yaml:"gracePeriod"`
+	FullSyncInterval time.Duration                 `yaml:"fullSyncInterval"`
+	Defaults         synchronizer.RepositoryPair   `yaml:"defaults"`
+	Repositories     []synchronizer.RepositoryPair `yaml:"repositories"`
+	Notifications    []synchronizer.NotifierConfig `yaml:"notifications"`
+	// Other configuration files whose repositories and notifications are read as well.
+	Include []string `yaml:"include"`
+	// Values of ${NAME} references in this file and the files it includes.
+	Variables map[string]string `yaml:"variables"`
+}
+
+// ConfigProblem describes a single issue found in the configuration file.
+type ConfigProblem struct {
+	Line    int
+	Message string
+}
+
+func (p ConfigProblem) String() string {
+	if p.Line > 0 {
+		return "line " + strconv.Itoa(p.Line) + ": " + p.Message
+	}
+	return p.Message
+}
+
+var yamlErrorLineRegexp = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// newConfigProblem converts YAML decoder error message into ConfigProblem with the line number extracted.
+func newConfigProblem(message string) ConfigProblem {
+	if match := yamlErrorLineRegexp.FindStringSubmatch(message); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return ConfigProblem{line, match[2]}
+	}
+	return ConfigProblem{0, message}
+}
+
+// ConfigFileProblem is a problem found in one of multiple configuration files.
+type ConfigFileProblem struct {
+	Path string
+	ConfigProblem
+}
+
+func (p ConfigFileProblem) String() string {
+	return p.Path + ": " + p.ConfigProblem.String()
+}
+
+// configLocation is the file and line at which a setting has been found.
+type configLocation struct {
+	path string
+	line int
+}
+
+// ValidateConfigFiles reads configuration files matched by pattern, together with the files they include,
+// and returns all problems found in them. Destinations are checked to be unique across all files.
+func ValidateConfigFiles(pattern string) []ConfigFileProblem {
+	sources, problems := readConfigFiles(pattern)
+	destinations := make(map[string]configLocation)
+	for _, source := range sources {
+		for _, p := range validateConfig(source.Data, source.Root, source.Path, source.Defaults, destinations) {
+			problems = append(problems, ConfigFileProblem{source.Path, p})
+		}
+	}
+	return problems
+}
+
+// ValidateConfig strictly decodes the configuration and returns all problems found in it:
+// unknown keys, invalid repository URLs, unknown authentication methods, missing token environment
+// variables, repositories synchronized to the same destination and misconfigured notifiers.
+func ValidateConfig(data []byte) []ConfigProblem {
+	root, _, problems := parseConfig(data, nil)
+	return append(problems, validateConfig(data, root, "", synchronizer.RepositoryPair{},
+		make(map[string]configLocation))...)
+}
+
+// validateConfig works like ValidateConfig for the configuration file at path, whose default settings,
+// including the ones inherited from files including it, are defaults. root is the parsed document with variables
+// expanded. Locations of destinations found in the file are added to destinations.
+func validateConfig(data []byte, root *yaml.Node, path string, defaults synchronizer.RepositoryPair,
+	destinations map[string]configLocation) []ConfigProblem {
+	var problems []ConfigProblem
+	var config configFile
+	// Unknown keys and types are checked in the file as written, while values are taken from root.
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(&config)
+	var typeError *yaml.TypeError
+	switch {
+	case errors.As(err, &typeError):
+		// Decoding continues after type errors, so the remaining checks can still be performed.
+		for _, e := range typeError.Errors {
+			problems = append(problems, newConfigProblem(e))
+		}
+	case err != nil && !errors.Is(err, io.EOF):
+		return append(problems, newConfigProblem(err.Error()))
+	}
+
+	config = configFile{}
+	// The document has already been parsed successfully above, and type errors have been reported.
+	_ = root.Decode(&config)
+	repositoryNodes := findYAMLKey(root, "repositories")
+
+	if config.LogFormat != "" && !slices.Contains(logFormats, config.LogFormat) {
+		problems = append(problems, ConfigProblem{yamlLine(findYAMLKey(root, "logFormat")),
+			"unknown logFormat " + config.LogFormat + ", supported formats are: " + strings.Join(logFormats, ", ")})
+	}
+	defaultsNode := findYAMLKey(root, "defaults")
+	problems = append(problems, validateRetryPolicy(config.Defaults.Retry, findYAMLKey(defaultsNode, "retry"))...)
+	problems = append(problems, validateRefPolicy(config.Defaults, defaultsNode)...)
+	problems = append(problems, validateSignaturePolicy(config.Defaults.VerifySignatures,
+		findYAMLKey(defaultsNode, "verify_signatures"))...)
+	problems = append(problems, validateConnectionSettings(config.Defaults.Source, "default source",
+		findYAMLKey(defaultsNode, "source"))...)
+	problems = append(problems, validateConnectionSettings(config.Defaults.Destination, "default destination",
+		findYAMLKey(defaultsNode, "destination"))...)
+	defaults = inheritDefaults(config.Defaults, defaults)
+	problems = append(problems, expandRepositoryURLs(config.Repositories, defaults, repositoryNodes)...)
+	synchronizer.SetRepositoryAuth(&config.Repositories, defaults)
+	resolved := append([]synchronizer.RepositoryPair(nil), config.Repositories...)
+	synchronizer.SetRepositoryRefPolicy(&resolved, defaults)
+	synchronizer.SetRepositorySignaturePolicy(&resolved, defaults)
+	synchronizer.SetRepositoryConnectionSettings(&resolved, defaults)
+	for i, repo := range config.Repositories {
+		var repositoryNode *yaml.Node
+		if repositoryNodes != nil && i < len(repositoryNodes.Content) {
+			repositoryNode = repositoryNodes.Content[i]
+		}
+		problems = append(problems,
+			validateRepository(repo.Source, "source", resolved[i].Source.Transport,
+				findYAMLKeyOrSelf(repositoryNode, "source"))...)
+		problems = append(problems,
+			validateRepository(repo.Destination, "destination", resolved[i].Destination.Transport,
+				findYAMLKeyOrSelf(repositoryNode, "destination"))...)
+		problems = append(problems, validateRetryPolicy(repo.Retry, findYAMLKey(repositoryNode, "retry"))...)
+		problems = append(problems, validateRefPolicy(repo, repositoryNode)...)
+		signaturesNode := findYAMLKey(repositoryNode, "verify_signatures")
+		problems = append(problems, validateSignaturePolicy(repo.VerifySignatures, signaturesNode)...)
+		if policy := resolved[i].VerifySignatures; policy.Enabled() && policy.Keyring == "" && policy.SSHKeys == "" {
+			// The policy may be inherited from defaults.
+			line := yamlLine(signaturesNode)
+			if signaturesNode == nil {
+				line = yamlLine(repositoryNode)
+			}
+			problems = append(problems, ConfigProblem{line,
+				"keyring or ssh_keys is required to verify signatures of refs pushed to " +
+					repo.Destination.RepositoryURL})
+		}
+		if resolved[i].UnprotectBranches && repo.Destination.Auth.Method != synchronizer.AuthMethodToken {
+			// Unprotecting branches may be enabled in defaults.
+			unprotectNode := findYAMLKey(repositoryNode, "unprotect_branches")
+			line := yamlLine(unprotectNode)
+			if unprotectNode == nil {
+				line = yamlLine(repositoryNode)
+			}
+			problems = append(problems, ConfigProblem{line,
+				"unprotect_branches requires token authentication for destination repository " +
+					repo.Destination.RepositoryURL})
+		}
+		if repo.Destination.RepositoryURL == "" {
+			continue
+		}
+		line := yamlLine(findYAMLKey(findYAMLKey(repositoryNode, "destination"), "repo"))
+		first, ok := destinations[repo.Destination.RepositoryURL]
+		switch {
+		case !ok:
+			destinations[repo.Destination.RepositoryURL] = configLocation{path, line}
+		case first.path == path:
+			problems = append(problems, ConfigProblem{line, fmt.Sprintf(
+				"destination %s is already used by the repository on line %d",
+				repo.Destination.RepositoryURL, first.line,
+			)})
+		default:
+			problems = append(problems, ConfigProblem{line, fmt.Sprintf(
+				"destination %s is already used by the repository on line %d of %s",
+				repo.Destination.RepositoryURL, first.line, first.path,
+			)})
+		}
+	}
+	problems = append(problems, validateNotifications(config.Notifications, findYAMLKey(root, "notifications"))...)
+	return problems
+}
+
+// expandRepositoryURLs sets URLs of named repositories from the templates and returns the templates which cannot
+// be expanded. nodes is the YAML node of the repository list used to determine line numbers.
+func expandRepositoryURLs(repositories []synchronizer.RepositoryPair, defaults synchronizer.RepositoryPair,
+	nodes *yaml.Node) []ConfigProblem {
+	var problems []ConfigProblem
+	for i := range repositories {
+		// The repository is updated in place.
+		repository := repositories[i : i+1]
+		if err := synchronizer.SetRepositoryURLs(&repository, defaults); err != nil {
+			var node *yaml.Node
+			if nodes != nil && i < len(nodes.Content) {
+				node = nodes.Content[i]
+			}
+			problems = append(problems, ConfigProblem{yamlLine(node), err.Error()})
+		}
+	}
+	return problems
+}
+
+// validateNotifications checks that notifiers have known types and events, and the settings they require.
+// node is the YAML node of the notifier list used to determine line numbers.
+func validateNotifications(notifications []synchronizer.NotifierConfig, node *yaml.Node) []ConfigProblem {
+	var problems []ConfigProblem
+	for i, notifier := range notifications {
+		var notifierNode *yaml.Node
+		if node != nil && i < len(node.Content) {
+			notifierNode = node.Content[i]
+		}
+		if _, err := synchronizer.NewNotificationRule(notifier); err != nil {
+			line := yamlLine(findYAMLKey(notifierNode, "type"))
+			if line == 0 {
+				line = yamlLine(notifierNode)
+			}
+			problems = append(problems, ConfigProblem{line, err.Error()})
+			continue
+		}
+		if notifier.URL != "" {
+			if err := validateRepositoryURL(notifier.URL); err != nil {
+				problems = append(problems, ConfigProblem{yamlLine(findYAMLKey(notifierNode, "url")),
+					"notifier URL " + notifier.URL + " is invalid: " + err.Error()})
+			}
+		}
+	}
+	return problems
+}
+
+// validateConnectionSettings checks proxy, TLS and transport settings of a source or destination repository.
+// node is the YAML node of the repository used to determine line numbers.
+func validateConnectionSettings(repository synchronizer.Repository, kind string, node *yaml.Node) []ConfigProblem {
+	var problems []ConfigProblem
+	subject := kind + " repository"
+	if repository.RepositoryURL != "" {
+		subject += " " + repository.RepositoryURL
+	}
+	for _, setting := range []struct {
+		key        string
+		name       string
+		repository synchronizer.Repository
+	}{
+		{"proxy", "proxy", synchronizer.Repository{Proxy: repository.Proxy}},
+		{"tls", "TLS settings", synchronizer.Repository{TLS: repository.TLS}},
+	} {
+		if err := setting.repository.ValidateConnectionSettings(); err != nil {
+			line := yamlLine(findYAMLKey(node, setting.key))
+			problems = append(problems, ConfigProblem{line, "invalid " + setting.name + " for " + subject + ": " +
+				err.Error()})
+		}
+	}
+	if err := repository.ValidateTransport(); err != nil {
+		problems = append(problems, ConfigProblem{yamlLine(findYAMLKey(node, "transport")),
+			"invalid transport for " + subject + ": " + err.Error()})
+	}
+	return problems
+}
+
+// validateRepository checks URL, authentication and connection settings of a single source or destination
+// repository. transport is the one used to access the repository, which may be inherited from defaults.
+// node is the YAML node of the repository used to determine line numbers.
+func validateRepository(repository synchronizer.Repository, kind, transport string, node *yaml.Node) []ConfigProblem {
+	problems := validateConnectionSettings(repository, kind, node)
+	repoLine := yamlLine(findYAMLKey(node, "repo"))
+	if repoLine == 0 {
+		repoLine = yamlLine(node)
+	}
+	local := synchronizer.IsLocalRepository(repository.RepositoryURL)
+	if repository.RepositoryURL == "" {
+		problems = append(problems, ConfigProblem{repoLine, kind + " repository URL is empty"})
+	} else if local && repository.Auth.Method != "" {
+		problems = append(problems, ConfigProblem{repoLine, "auth cannot be used with local " + kind +
+			" repository " + repository.RepositoryURL})
+		return problems
+	} else if err := validateRepositoryURL(repository.RepositoryURL); !local && err != nil &&
+		!(transport == synchronizer.TransportExec && isSSHURL(repository.RepositoryURL)) {
+		problems = append(problems, ConfigProblem{repoLine, kind + " repository URL " +
+			repository.RepositoryURL + " is invalid: " + err.Error()})
+	}
+
+	authNode := findYAMLKey(node, "auth")
+	methodLine := yamlLine(findYAMLKey(authNode, "method"))
+	if methodLine == 0 {
+		methodLine = repoLine
+	}
+	switch repository.Auth.Method {
+	case "":
+	case synchronizer.AuthMethodToken:
+		tokenLine := yamlLine(findYAMLKey(authNode, "token_name"))
+		if tokenLine == 0 {
+			tokenLine = methodLine
+		}
+		if repository.Auth.TokenName == "" {
+			problems = append(problems, ConfigProblem{tokenLine, "token_name for " + kind + " repository " +
+				repository.RepositoryURL + " is empty"})
+		} else if os.Getenv(repository.Auth.TokenName) == "" {
+			problems = append(problems, ConfigProblem{tokenLine, "environment variable " +
+				repository.Auth.TokenName + " with token for " + kind + " repository " +
+				repository.RepositoryURL + " is not set"})
+		}
+	default:
+		problems = append(problems, ConfigProblem{methodLine, "unknown auth method " + repository.Auth.Method +
+			" for " + kind + " repository " + repository.RepositoryURL})
+	}
+	return problems
+}
+
+// validateRetryPolicy checks that retry settings are not negative. node is the YAML node
+// of the retry settings used to determine line numbers.
+func validateRetryPolicy(policy synchronizer.RetryPolicy, node *yaml.Node) []ConfigProblem {
+	var problems []ConfigProblem
+	durations := []struct {
+		key   string
+		value time.Duration
+	}{
+		{"max_elapsed_time", policy.MaxElapsedTime},
+		{"initial_interval", policy.InitialInterval},
+		{"max_interval", policy.MaxInterval},
+		{"list_timeout", policy.ListTimeout},
+		{"transfer_timeout", policy.TransferTimeout},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			problems = append(problems, ConfigProblem{yamlLine(findYAMLKey(node, d.key)), d.key + " must not be negative"})
+		}
+	}
+	if policy.InitialInterval > 0 && policy.MaxInterval > 0 && policy.InitialInterval > policy.MaxInterval {
+		problems = append(problems, ConfigProblem{yamlLine(findYAMLKey(node, "initial_interval")),
+			"initial_interval must not be greater than max_interval"})
+	}
+	return problems
+}
+
+// validateRefPolicy checks mode, preserve patterns and tag policy of repository pair. node is the YAML node
+// of the repository pair used to determine line numbers.
+func validateRefPolicy(repo synchronizer.RepositoryPair, node *yaml.Node) []ConfigProblem {
+	var problems []ConfigProblem
+	if repo.Mode != "" && repo.Mode != synchronizer.ModeMirror && repo.Mode != synchronizer.ModeAdditive {
+		problems = append(problems, ConfigProblem{yamlLine(findYAMLKey(node, "mode")), "unknown mode " + repo.Mode})
+	}
+	preserveNode := findYAMLKey(node, "preserve")
+	for i, pattern := range repo.Preserve {
+		if err := synchronizer.ValidatePattern(pattern); err != nil {
+			line := yamlLine(preserveNode)
+			if preserveNode != nil && i < len(preserveNode.Content) {
+				line = yamlLine(preserveNode.Content[i])
+			}
+			problems = append(problems, ConfigProblem{line, "invalid preserve pattern " + pattern})
+		}
+	}
+	switch repo.TagPolicy {
+	case "", synchronizer.TagPolicyForce, synchronizer.TagPolicyImmutable, synchronizer.TagPolicySkip:
+	default:
+		problems = append(problems, ConfigProblem{yamlLine(findYAMLKey(node, "tag_policy")),
+			"unknown tag policy " + repo.TagPolicy})
+	}
+	if repo.TagsOnly && repo.TagPolicy == synchronizer.TagPolicySkip {
+		problems = append(problems, ConfigProblem{yamlLine(findYAMLKey(node, "tags_only")),
+			"tags_only cannot be used with tag policy skip"})
+	}
+	return problems
+}
+
+// validateSignaturePolicy checks that branch patterns are valid and key files can be read. node is the YAML node
+// of the signature verification settings used to determine line numbers.
+func validateSignaturePolicy(policy synchronizer.SignaturePolicy, node *yaml.Node) []ConfigProblem {
+	var problems []ConfigProblem
+	branchesNode := findYAMLKey(node, "branches")
+	for i, pattern := range policy.Branches {
+		if err := synchronizer.ValidatePattern(pattern); err != nil {
+			line := yamlLine(branchesNode)
+			if branchesNode != nil && i < len(branchesNode.Content) {
+				line = yamlLine(branchesNode.Content[i])
+			}
+			problems = append(problems, ConfigProblem{line, "invalid branch pattern " + pattern})
+		}
+	}
+	for _, key := range []struct{ name, file string }{{"keyring", policy.Keyring}, {"ssh_keys", policy.SSHKeys}} {
+		if key.file == "" {
+			continue
+		}
+		if _, err := os.Stat(key.file); err != nil {
+			problems = append(problems, ConfigProblem{yamlLine(findYAMLKey(node, key.name)),
+				"cannot read " + key.name + ": " + err.Error()})
+		}
+	}
+	return problems
+}
+
+// validateRepositoryURL checks whether repositoryURL can be used with the HTTP(S) transport.
+func validateRepositoryURL(repositoryURL string) error {
+	u, err := url.Parse(repositoryURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("only http and https URLs are supported")
+	}
+	if u.Host == "" {
+		return errors.New("host is missing")
+	}
+	return nil
+}
+
+// isSSHURL returns true if repositoryURL is an SSH URL, which is supported by the exec transport.
+// Besides ssh:// URLs, the scp-like syntax is recognized, e.g. git@github.com:org-1/repo-1.git.
+func isSSHURL(repositoryURL string) bool {
+	if strings.HasPrefix(repositoryURL, "ssh://") {
+		return true
+	}
+	host, _, found := strings.Cut(repositoryURL, ":")
+	return found && host != "" && !strings.Contains(host, "/") && !strings.Contains(repositoryURL, "://")
+}
+
+// findYAMLKey returns the value node of key in mapping node, or nil if it does not exist.
+func findYAMLKey(node *yaml.Node, key string) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// findYAMLKeyOrSelf works like findYAMLKey, but returns node itself if key does not exist, so that problems with
+// settings derived from other keys are reported on the line of node.
+func findYAMLKeyOrSelf(node *yaml.Node, key string) *yaml.Node {
+	if value := findYAMLKey(node, key); value != nil {
+		return value
+	}
+	return node
+}
+
+func yamlLine(node *yaml.Node) int {
+	if node == nil {
+		return 0
+	}
+	return node.Line
+}
+
+// validateConfiguration logs all problems found in the configuration files and terminates the program
+// if there are any.
+func validateConfiguration() {
+	pattern := configPattern()
+	if pattern == "" {
+		return
+	}
+	problems := ValidateConfigFiles(pattern)
+	for _, p := range problems {
+		log.Error(p)
+	}
+	if len(problems) > 0 {
+		log.Error("Configuration ", pattern, " is invalid.")
+		os.Exit(exitCodeConfigError)
+	}
+}
+
+func newValidateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the configuration files.",
+		Long: `Strictly validate the configuration files, including the ones they include, and print all problems
+found in them. Exits with a non-zero status if the configuration is invalid.`,
+		Run: func(_ *cobra.Command, _ []string) {
+			pattern := configPattern()
+			problems := ValidateConfigFiles(pattern)
+			for _, p := range problems {
+				fmt.Println(p.String())
+			}
+			if len(problems) > 0 {
+				os.Exit(exitCodeConfigError)
+			}
+			config := synchronizer.Config{Defaults: defaultSettings, Repositories: inputRepositories}
+			warnInsecureRepositories(config.Resolve())
+			fmt.Println("Configuration " + pattern + " is valid.")
+		},
+	}
+}
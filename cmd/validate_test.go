@@ -0,0 +1,232 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ValidateConfig(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "github-token")
+	t.Setenv("GITLAB_TOKEN", "")
+	config := `defaults:
+  source:
+    auth:
+      method: token
+      token_name: GITHUB_TOKEN
+repositories:
+  - source:
+      repo: https://github.example.com/org-1/repo-1
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-1
+      auth:
+        method: token
+        toke_name: GITLAB_TOKEN
+  - source:
+      repo: github.example.com/org-1/repo-2
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-1
+      auth:
+        method: password
+  - source:
+      repo: https://github.example.com/org-1/repo-3
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-3
+      auth:
+        method: token
+        token_name: GITLAB_TOKEN
+`
+	problems := ValidateConfig([]byte(config))
+	assert.Equal(t, []ConfigProblem{
+		{13, "field toke_name not found in type synchronizer.Authentication"},
+		{12, "token_name for destination repository https://gitlab.example.com/org-5/repo-1 is empty"},
+		{15, "source repository URL github.example.com/org-1/repo-2 is invalid: " +
+			"only http and https URLs are supported"},
+		{19, "unknown auth method password for destination repository https://gitlab.example.com/org-5/repo-1"},
+		{17, "destination https://gitlab.example.com/org-5/repo-1 is already used by the repository on line 10"},
+		{26, "environment variable GITLAB_TOKEN with token for destination repository " +
+			"https://gitlab.example.com/org-5/repo-3 is not set"},
+	}, problems)
+}
+
+func Test_ValidateConfigSyntaxError(t *testing.T) {
+	problems := ValidateConfig([]byte("repositories:\n  - source: [\n"))
+	assert.Len(t, problems, 1)
+	assert.Equal(t, 2, problems[0].Line)
+}
+
+func Test_ValidateConfigNotifications(t *testing.T) {
+	config := `notifications:
+  - type: slack
+    url: https://hooks.slack.example.com/services/1
+  - type: webhook
+  - type: command
+    command: ./notify.sh
+    events: [push]
+`
+	assert.Equal(t, []ConfigProblem{
+		{4, "webhook notifier requires url"},
+		{5, "unknown notification event: push"},
+	}, ValidateConfig([]byte(config)))
+}
+
+func Test_ValidateConfigRefPolicy(t *testing.T) {
+	config := `defaults:
+  mode: append
+repositories:
+  - source:
+      repo: https://github.example.com/org-1/repo-1
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-1
+    preserve:
+      - internal/*
+      - release/[
+    tag_policy: keep
+  - source:
+      repo: https://github.example.com/org-1/repo-2
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-2
+    tag_policy: skip
+    tags_only: true
+`
+	assert.Equal(t, []ConfigProblem{
+		{2, "unknown mode append"},
+		{10, "invalid preserve pattern release/["},
+		{11, "unknown tag policy keep"},
+		{17, "tags_only cannot be used with tag policy skip"},
+	}, ValidateConfig([]byte(config)))
+}
+
+func Test_ValidateConfigUnprotectBranches(t *testing.T) {
+	t.Setenv("GITLAB_TOKEN", "secret")
+	config := `defaults:
+  unprotect_branches: true
+repositories:
+  - source:
+      repo: https://github.example.com/org-1/repo-1
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-1
+      auth:
+        method: token
+        token_name: GITLAB_TOKEN
+  - source:
+      repo: https://github.example.com/org-1/repo-2
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-2
+`
+	assert.Equal(t, []ConfigProblem{
+		{11, "unprotect_branches requires token authentication for destination repository " +
+			"https://gitlab.example.com/org-5/repo-2"},
+	}, ValidateConfig([]byte(config)))
+}
+
+func Test_ValidateConfigSignatures(t *testing.T) {
+	config := `defaults:
+  verify_signatures:
+    tags: true
+repositories:
+  - source:
+      repo: https://github.example.com/org-1/repo-1
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-1
+    verify_signatures:
+      keyring: /nonexistent/keyring.asc
+      branches:
+        - release/[
+  - source:
+      repo: https://github.example.com/org-1/repo-2
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-2
+`
+	assert.Equal(t, []ConfigProblem{
+		{12, "invalid branch pattern release/["},
+		{10, "cannot read keyring: stat /nonexistent/keyring.asc: no such file or directory"},
+		{13, "keyring or ssh_keys is required to verify signatures of refs pushed to " +
+			"https://gitlab.example.com/org-5/repo-2"},
+	}, ValidateConfig([]byte(config)))
+}
+
+func Test_ValidateConfigLocalRepositories(t *testing.T) {
+	config := `repositories:
+  - source:
+      repo: file:///srv/git/repo-1.git
+    destination:
+      repo: /mnt/backup/repo-1.git
+  - source:
+      repo: ./repo-2
+    destination:
+      repo: ../backup/repo-2.git
+      auth:
+        method: token
+        token_name: GITLAB_TOKEN
+`
+	assert.Equal(t, []ConfigProblem{
+		{9, "auth cannot be used with local destination repository ../backup/repo-2.git"},
+	}, ValidateConfig([]byte(config)))
+}
+
+func Test_ValidateConfigConnectionSettings(t *testing.T) {
+	config := `defaults:
+  source:
+    proxy: proxy.example.com:3128
+repositories:
+  - source:
+      repo: https://github.example.com/org-1/repo-1
+      proxy: http://proxy.example.com:3128
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-1
+      tls:
+        client_key: key.pem
+      transport: git
+`
+	assert.Equal(t, []ConfigProblem{
+		{3, "invalid proxy for default source repository: proxy URL proxy.example.com:3128 must include " +
+			"scheme and host"},
+		{11, "invalid TLS settings for destination repository https://gitlab.example.com/org-5/repo-1: " +
+			"client certificate and client key must be set together"},
+		{12, "invalid transport for destination repository https://gitlab.example.com/org-5/repo-1: " +
+			"unknown transport git, supported transports are: go-git, exec"},
+	}, ValidateConfig([]byte(config)))
+}
+
+func Test_ValidateConfigTransport(t *testing.T) {
+	config := `defaults:
+  source:
+    transport: exec
+repositories:
+  - source:
+      repo: git@github.example.com:org-1/repo-1.git
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-1
+  - source:
+      repo: ssh://github.example.com/org-1/repo-2.git
+    destination:
+      repo: ssh://gitlab.example.com/org-5/repo-2.git
+`
+	assert.Equal(t, []ConfigProblem{
+		{12, "destination repository URL ssh://gitlab.example.com/org-5/repo-2.git is invalid: " +
+			"only http and https URLs are supported"},
+	}, ValidateConfig([]byte(config)))
+}
+
+func Test_ValidateConfigLogFormat(t *testing.T) {
+	assert.Empty(t, ValidateConfig([]byte("logFormat: json\n")))
+	assert.Equal(t, []ConfigProblem{{2, "unknown logFormat yaml, supported formats are: text, json"}},
+		ValidateConfig([]byte("logLevel: debug\nlogFormat: yaml\n")))
+}
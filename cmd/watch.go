@@ -0,0 +1,184 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/insightsengineering/git-synchronizer/synchronizer"
+)
+
+// Time between consecutive synchronizations. Zero means that synchronization runs once.
+var syncInterval time.Duration
+
+// Time for which changes to configuration files are collected before the configuration is reloaded,
+// so that files saved in several steps are only reloaded once.
+const configReloadDelay = time.Second
+
+// activeConfig is the set of repositories synchronized periodically, replaced as a whole when
+// configuration files change.
+type activeConfig struct {
+	repositories []synchronizer.RepositoryPair
+	notifiers    []synchronizer.NotifierConfig
+	// Paths of all configuration files, watched for changes.
+	files []string
+}
+
+// configHolder holds the configuration used by periodic synchronization.
+type configHolder struct {
+	pattern string
+	active  atomic.Pointer[activeConfig]
+}
+
+// reload reads and validates the configuration files. The active configuration is only replaced
+// if they are valid.
+func (h *configHolder) reload() error {
+	var allErrors []error
+	for _, p := range ValidateConfigFiles(h.pattern) {
+		allErrors = append(allErrors, errors.New(p.String()))
+	}
+	if len(allErrors) > 0 {
+		return errors.Join(allErrors...)
+	}
+	config, err := readConfig(h.pattern)
+	if err != nil {
+		return err
+	}
+	repositories, err := resolveRepositories(config.repositories, config.defaults)
+	if err != nil {
+		return err
+	}
+	h.active.Store(&activeConfig{repositories, config.notifiers, config.files})
+	return nil
+}
+
+// watchedDirectories returns directories in which changes may affect the configuration: the ones containing
+// the configuration files and the one matched by the --config pattern.
+func (h *configHolder) watchedDirectories() []string {
+	directories := []string{h.pattern}
+	if info, err := os.Stat(h.pattern); err != nil || !info.IsDir() {
+		directories[0] = filepath.Dir(h.pattern)
+	}
+	if config := h.active.Load(); config != nil {
+		for _, file := range config.files {
+			directories = append(directories, filepath.Dir(file))
+		}
+	}
+	return directories
+}
+
+// isConfigFile returns true if path may be a configuration file.
+func (h *configHolder) isConfigFile(path string) bool {
+	if extension := filepath.Ext(path); extension == ".yml" || extension == ".yaml" {
+		return true
+	}
+	if config := h.active.Load(); config != nil {
+		for _, file := range config.files {
+			if filepath.Clean(file) == filepath.Clean(path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// watch reloads the configuration whenever configuration files change, until ctx is cancelled.
+// Invalid configuration is logged and the previous one stays in use.
+func (h *configHolder) watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	addWatches := func() {
+		for _, directory := range h.watchedDirectories() {
+			// Adding a directory which is already watched has no effect.
+			if watchErr := watcher.Add(directory); watchErr != nil {
+				log.Warn("Cannot watch ", directory, " for configuration changes: ", watchErr)
+			}
+		}
+	}
+	addWatches()
+	go func() {
+		defer watcher.Close()
+		var reload <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if h.isConfigFile(event.Name) {
+					reload = time.After(configReloadDelay)
+				}
+			case watchErr, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn("Error while watching configuration files: ", watchErr)
+			case <-reload:
+				reload = nil
+				if reloadErr := h.reload(); reloadErr != nil {
+					log.Error("Configuration has changed but is invalid, keeping the previous one: ", reloadErr)
+					continue
+				}
+				log.Info("Configuration has been reloaded, ", len(h.active.Load().repositories),
+					" repositories will be synchronized.")
+				addWatches()
+			}
+		}
+	}()
+	return nil
+}
+
+// synchronizePeriodically synchronizes the repositories every syncInterval until ctx is cancelled,
+// using the most recent valid configuration for each synchronization.
+func synchronizePeriodically(ctx context.Context, repositories []synchronizer.RepositoryPair) {
+	holder := &configHolder{pattern: configPattern()}
+	holder.active.Store(&activeConfig{repositories: repositories, notifiers: notifiers})
+	if holder.pattern != "" {
+		if err := holder.reload(); err != nil {
+			log.Error(err)
+			os.Exit(exitCodeConfigError)
+		}
+		checkError(holder.watch(ctx))
+	}
+	for {
+		config := holder.active.Load()
+		result, err := mirror(ctx, config.repositories,
+			synchronizer.WithNotifications(notificationRules(config.notifiers)...))
+		if err != nil {
+			logResult(result)
+			log.Error(err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Info("Next synchronization in ", syncInterval, ".")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(syncInterval):
+		}
+	}
+}
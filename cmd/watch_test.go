@@ -0,0 +1,82 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const watchedConfig = `include:
+  - teams
+repositories:
+  - source:
+      repo: https://github.example.com/org-1/repo-1
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-1
+`
+
+const watchedTeamConfig = `repositories:
+  - source:
+      repo: https://github.example.com/team-a/repo-2
+    destination:
+      repo: https://gitlab.example.com/team-a/repo-2
+`
+
+func Test_configHolder_reload(t *testing.T) {
+	directory := writeConfigFiles(t, map[string]string{"main.yml": watchedConfig, "teams/a.yml": watchedTeamConfig})
+	holder := &configHolder{pattern: filepath.Join(directory, "main.yml")}
+	assert.NoError(t, holder.reload())
+	active := holder.active.Load()
+	assert.Len(t, active.repositories, 2)
+	assert.Equal(t, []string{holder.pattern, filepath.Join(directory, "teams", "a.yml")}, active.files)
+	assert.Subset(t, holder.watchedDirectories(), []string{directory, filepath.Join(directory, "teams")})
+
+	// Invalid configuration does not replace the active one.
+	assert.NoError(t, os.WriteFile(filepath.Join(directory, "teams", "b.yml"), []byte(`repositories:
+  - source:
+      repo: https://github.example.com/org-2/repo-1
+    destination:
+      repo: https://gitlab.example.com/org-5/repo-1
+`), 0600))
+	assert.ErrorContains(t, holder.reload(), "destination https://gitlab.example.com/org-5/repo-1 is already used")
+	assert.Same(t, active, holder.active.Load())
+}
+
+func Test_configHolder_watch(t *testing.T) {
+	directory := writeConfigFiles(t, map[string]string{"main.yml": watchedConfig, "teams/a.yml": watchedTeamConfig})
+	holder := &configHolder{pattern: filepath.Join(directory, "main.yml")}
+	assert.NoError(t, holder.reload())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, holder.watch(ctx))
+
+	// Files added to included directories are picked up.
+	assert.NoError(t, os.WriteFile(filepath.Join(directory, "teams", "b.yml"),
+		[]byte(`repositories:
+  - source:
+      repo: https://github.example.com/team-b/repo-3
+    destination:
+      repo: https://gitlab.example.com/team-b/repo-3
+`), 0600))
+	assert.Eventually(t, func() bool { return len(holder.active.Load().repositories) == 3 },
+		5*time.Second, 50*time.Millisecond)
+}
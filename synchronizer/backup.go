@@ -0,0 +1,444 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// BackupFormatBundle stores snapshots as git bundles.
+const BackupFormatBundle = "bundle"
+
+// BackupFormatArchive stores snapshots as gzip-compressed tar archives of bare repositories.
+const BackupFormatArchive = "archive"
+
+// Snapshot files are named after the time at which they have been created.
+const snapshotTimeFormat = "20060102T150405.000Z"
+
+// BackupOptions describe how snapshots are stored and how many of them are retained.
+type BackupOptions struct {
+	// BackupFormatBundle or BackupFormatArchive.
+	Format string
+	// Number of days for which the most recent snapshot of each day is kept.
+	KeepDaily int
+	// Number of weeks for which the most recent snapshot of each week is kept.
+	// If both KeepDaily and KeepWeekly are 0, all snapshots are kept.
+	KeepWeekly int
+}
+
+// SnapshotManifest describes a point-in-time snapshot of the source repository of a repository pair.
+type SnapshotManifest struct {
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Created     time.Time `json:"created"`
+	Format      string    `json:"format"`
+	// Name of the snapshot file, in the same directory as the manifest.
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+	// Hashes of branches and tags in the snapshot, keyed by ref name.
+	Refs map[string]string `json:"refs"`
+}
+
+// ReadSnapshotManifest reads the manifest of a snapshot written by Backup.
+func ReadSnapshotManifest(manifestPath string) (SnapshotManifest, error) {
+	var manifest SnapshotManifest
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(data, &manifest)
+	return manifest, err
+}
+
+// Backup writes a snapshot of the source repository of each repositoryPair, together with a manifest
+// listing its refs and checksum, to a subdirectory of directory named after the destination repository.
+// Snapshots not covered by the retention rules in options are removed afterwards.
+func (s *Syncer) Backup(ctx context.Context, repos []RepositoryPair, directory string,
+	options BackupOptions) (Result, error) {
+	if options.Format != BackupFormatBundle && options.Format != BackupFormatArchive {
+		return Result{}, fmt.Errorf("unknown backup format %s", options.Format)
+	}
+	return s.run(ctx, repos, "Backing up", operationBackup, func(ctx context.Context, messages chan MirrorStatus,
+		repositoryPair RepositoryPair, _ *RepositoryState) {
+		s.backupRepository(ctx, messages, repositoryPair, filepath.Join(directory, bundleName(repositoryPair)),
+			options)
+	})
+}
+
+// Restore pushes branches and tags from the snapshot described by the manifest to the destination repository
+// of repositoryPair. Branches and tags not present in the snapshot are removed from the destination
+// in the same way as by Mirror.
+func (s *Syncer) Restore(ctx context.Context, manifestPath string, repositoryPair RepositoryPair) (Result, error) {
+	return s.run(ctx, []RepositoryPair{repositoryPair}, "Restoring", operationRestore, func(ctx context.Context,
+		messages chan MirrorStatus, repositoryPair RepositoryPair, _ *RepositoryState) {
+		s.restoreSnapshot(ctx, messages, repositoryPair, manifestPath)
+	})
+}
+
+// backupRepository clones the source repository of repositoryPair and writes its snapshot to directory.
+func (s *Syncer) backupRepository(ctx context.Context, messages chan MirrorStatus, repositoryPair RepositoryPair,
+	directory string, options BackupOptions) {
+	source, destination := repositoryPair.Source.RepositoryURL, repositoryPair.Destination.RepositoryURL
+	var allErrors []SyncError
+	status := MirrorStatus{Source: source, Destination: destination}
+	defer func() {
+		status.Errors = allErrors
+		status.Cancelled = ctx.Err() != nil
+		if status.LastCloneEnd.IsZero() {
+			status.LastCloneEnd = time.Now()
+		}
+		s.progress.Finished(status)
+		messages <- status
+	}()
+
+	repositoryLog := s.logger.WithFields(logrus.Fields{"source": source, "destination": destination})
+	s.progress.Phase(source, destination, PhaseCloning, 0, 0)
+	cloneStart := time.Now()
+	gitDirectory, err := os.MkdirTemp(s.workingDirectory, "")
+	if err != nil {
+		ProcessError(repositoryLog.WithField("phase", "clone"), err, "creating temporary directory for ", source,
+			&allErrors)
+		return
+	}
+	defer os.RemoveAll(gitDirectory)
+	repository, _, _ := s.cloneSource(ctx, gitDirectory, repositoryPair, repositoryLog, &allErrors)
+	if repository == nil {
+		return
+	}
+	status.CloneDuration = time.Since(cloneStart)
+	status.LastCloneEnd = time.Now()
+
+	backupLog := repositoryLog.WithField("phase", "backup")
+	// The clone is bare with the exec transport, so its git directory is taken from the storer.
+	repositoryGitDirectory, err := repositoryDirectory(repository)
+	if err != nil {
+		ProcessError(backupLog, err, "locating clone of ", source, &allErrors)
+		return
+	}
+	manifestPath, err := writeSnapshot(repository, repositoryGitDirectory, repositoryPair, directory, options.Format)
+	if err != nil {
+		ProcessError(backupLog, err, "writing snapshot of ", source, &allErrors)
+		return
+	}
+	backupLog.Info("Written snapshot ", manifestPath, ".")
+	status.Snapshot = manifestPath
+	if err = removeExpiredSnapshots(directory, options, backupLog); err != nil {
+		ProcessError(backupLog, err, "removing expired snapshots of ", source, &allErrors)
+	}
+}
+
+// writeSnapshot writes a snapshot of repository, whose git directory is gitDirectory, in the given format
+// to directory. The path of the snapshot manifest is returned.
+func writeSnapshot(repository *git.Repository, gitDirectory string, repositoryPair RepositoryPair,
+	directory, format string) (string, error) {
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return "", err
+	}
+	manifest := SnapshotManifest{
+		Source: repositoryPair.Source.RepositoryURL, Destination: repositoryPair.Destination.RepositoryURL,
+		Created: time.Now().UTC(), Format: format, Refs: make(map[string]string),
+	}
+	addPushedRefs(repository, refBranchPrefix, manifest.Refs)
+	addPushedRefs(repository, refTagPrefix, manifest.Refs)
+	name := manifest.Created.Format(snapshotTimeFormat)
+	checksum := sha256.New()
+	var err error
+	switch format {
+	case BackupFormatBundle:
+		manifest.File = name + ".bundle"
+		err = writeFileAtomically(filepath.Join(directory, manifest.File), func(w io.Writer) error {
+			return writeBundle(io.MultiWriter(w, checksum), repository, manifest.Refs, nil)
+		})
+	case BackupFormatArchive:
+		manifest.File = name + ".tar.gz"
+		err = writeFileAtomically(filepath.Join(directory, manifest.File), func(w io.Writer) error {
+			return writeArchive(io.MultiWriter(w, checksum), repository, gitDirectory)
+		})
+	default:
+		err = fmt.Errorf("unknown backup format %s", format)
+	}
+	if err != nil {
+		return "", err
+	}
+	manifest.SHA256 = hex.EncodeToString(checksum.Sum(nil))
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	manifestPath := filepath.Join(directory, name+".json")
+	return manifestPath, writeFileAtomically(manifestPath, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeArchive writes gitDirectory of repository as a gzip-compressed tar archive of a bare repository to w.
+func writeArchive(w io.Writer, repository *git.Repository, gitDirectory string) error {
+	config, err := repository.Config()
+	if err != nil {
+		return err
+	}
+	config.Core.IsBare = true
+	if err = repository.SetConfig(config); err != nil {
+		return err
+	}
+	compressed := gzip.NewWriter(w)
+	archive := tar.NewWriter(compressed)
+	err = filepath.WalkDir(gitDirectory, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || filePath == gitDirectory || entry.Name() == "index" {
+			// The index only describes the working tree, which is not archived.
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(gitDirectory, filePath)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relativePath)
+		if entry.IsDir() {
+			header.Name += "/"
+		}
+		if err = archive.WriteHeader(header); err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		f, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(archive, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err = archive.Close(); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+// extractArchive extracts a gzip-compressed tar archive written by writeArchive to directory.
+func extractArchive(archivePath, directory string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	compressed, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	archive := tar.NewReader(compressed)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(header.Name) {
+			return fmt.Errorf("invalid path %s in %s", header.Name, archivePath)
+		}
+		filePath := filepath.Join(directory, header.Name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(filePath, os.ModePerm)
+		case tar.TypeReg:
+			err = extractFile(archive, filePath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(r io.Reader, filePath string) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// keep returns which of the snapshots created at the given times, ordered from the newest one, are retained
+// according to options. The newest snapshot is always retained.
+func (options BackupOptions) keep(created []time.Time) []bool {
+	keep := make([]bool, len(created))
+	days, weeks := make(map[string]bool), make(map[string]bool)
+	for i, t := range created {
+		t = t.UTC()
+		day := t.Format(time.DateOnly)
+		year, week := t.ISOWeek()
+		weekName := fmt.Sprintf("%d-%d", year, week)
+		keep[i] = options.KeepDaily == 0 && options.KeepWeekly == 0
+		if !days[day] && len(days) < options.KeepDaily {
+			days[day] = true
+			keep[i] = true
+		}
+		if !weeks[weekName] && len(weeks) < options.KeepWeekly {
+			weeks[weekName] = true
+			keep[i] = true
+		}
+	}
+	if len(keep) > 0 {
+		keep[0] = true
+	}
+	return keep
+}
+
+// removeExpiredSnapshots removes snapshots in directory which are not retained according to options.
+func removeExpiredSnapshots(directory string, options BackupOptions, logger *logrus.Entry) error {
+	manifestPaths, err := filepath.Glob(filepath.Join(directory, "*.json"))
+	if err != nil {
+		return err
+	}
+	manifests := make(map[string]SnapshotManifest)
+	for _, manifestPath := range manifestPaths {
+		if manifests[manifestPath], err = ReadSnapshotManifest(manifestPath); err != nil {
+			return err
+		}
+	}
+	sort.Slice(manifestPaths, func(i, j int) bool {
+		return manifests[manifestPaths[i]].Created.After(manifests[manifestPaths[j]].Created)
+	})
+	created := make([]time.Time, len(manifestPaths))
+	for i, manifestPath := range manifestPaths {
+		created[i] = manifests[manifestPath].Created
+	}
+	for i, keep := range options.keep(created) {
+		if keep {
+			continue
+		}
+		manifestPath := manifestPaths[i]
+		logger.Info("Removing expired snapshot ", manifestPath, ".")
+		err = os.Remove(filepath.Join(directory, manifests[manifestPath].File))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err = os.Remove(manifestPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreSnapshot pushes branches and tags from the snapshot described by the manifest to the destination
+// of repositoryPair.
+func (s *Syncer) restoreSnapshot(ctx context.Context, messages chan MirrorStatus, repositoryPair RepositoryPair,
+	manifestPath string) {
+	source, destination := repositoryPair.Source.RepositoryURL, repositoryPair.Destination.RepositoryURL
+	var allErrors []SyncError
+	status := MirrorStatus{Source: source, Destination: destination, Refs: make(map[string]string)}
+	defer func() {
+		status.Errors = allErrors
+		status.Cancelled = ctx.Err() != nil
+		if status.LastCloneEnd.IsZero() {
+			status.LastCloneEnd = time.Now()
+		}
+		s.progress.Finished(status)
+		messages <- status
+	}()
+
+	repositoryLog := s.logger.WithFields(logrus.Fields{"source": source, "destination": destination})
+	restoreLog := repositoryLog.WithField("phase", "restore")
+	s.progress.Phase(source, destination, PhaseFetching, 0, 0)
+	restoreStart := time.Now()
+	gitDirectory, err := os.MkdirTemp(s.workingDirectory, "")
+	if err != nil {
+		ProcessError(restoreLog, err, "creating temporary directory for ", destination, &allErrors)
+		return
+	}
+	defer os.RemoveAll(gitDirectory)
+	repository, refs, err := s.readSnapshot(ctx, gitDirectory, repositoryPair, manifestPath, restoreLog)
+	if err != nil {
+		ProcessError(restoreLog, err, "restoring snapshot to ", destination, &allErrors)
+		return
+	}
+	sourceBranchList, sourceTagList, err := setReferences(repository, refs)
+	if err != nil {
+		ProcessError(restoreLog, err, "restoring snapshot to ", destination, &allErrors)
+		return
+	}
+	status.CloneDuration = time.Since(restoreStart)
+	status.LastCloneEnd = time.Now()
+	pushStart := time.Now()
+	defer func() { status.PushDuration = time.Since(pushStart) }()
+
+	s.pushRepository(ctx, repository, repositoryPair, sourceBranchList, sourceTagList, repositoryLog, &status,
+		&allErrors)
+}
+
+// readSnapshot verifies the snapshot described by the manifest and unpacks it into a repository in gitDirectory.
+// Refs from the snapshot are returned.
+func (s *Syncer) readSnapshot(ctx context.Context, gitDirectory string, repositoryPair RepositoryPair,
+	manifestPath string, logger *logrus.Entry) (*git.Repository, map[string]string, error) {
+	manifest, err := ReadSnapshotManifest(manifestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshotPath := filepath.Join(filepath.Dir(manifestPath), manifest.File)
+	if err = verifyChecksum(snapshotPath, manifest.SHA256); err != nil {
+		return nil, nil, err
+	}
+	logger.Info("Restoring snapshot of ", manifest.Source, " created at ", manifest.Created.Local(), ".")
+	switch manifest.Format {
+	case BackupFormatBundle:
+		repository, err := git.PlainInit(gitDirectory, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		refs, err := s.unpackBundle(ctx, repository, repositoryPair, snapshotPath, true, logger)
+		return repository, refs, err
+	case BackupFormatArchive:
+		if err = extractArchive(snapshotPath, gitDirectory); err != nil {
+			return nil, nil, err
+		}
+		repository, err := git.PlainOpen(gitDirectory)
+		return repository, manifest.Refs, err
+	}
+	return nil, nil, fmt.Errorf("unknown backup format %s", manifest.Format)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	gitplumbing "github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BackupOptions_keep(t *testing.T) {
+	// Sunday 2024-06-16 is the last day of ISO week 24.
+	newest := time.Date(2024, 6, 18, 12, 0, 0, 0, time.UTC)
+	created := []time.Time{
+		newest,
+		newest.Add(-time.Hour),           // Same day as the newest one.
+		newest.Add(-24 * time.Hour),      // 2024-06-17, week 25.
+		newest.Add(-48 * time.Hour),      // 2024-06-16, week 24.
+		newest.Add(-72 * time.Hour),      // 2024-06-15, week 24.
+		newest.Add(-8 * 24 * time.Hour),  // 2024-06-10, week 24.
+		newest.Add(-15 * 24 * time.Hour), // 2024-06-03, week 23.
+	}
+	assert.Equal(t, []bool{true, false, true, false, false, false, false},
+		BackupOptions{KeepDaily: 2}.keep(created))
+	assert.Equal(t, []bool{true, false, false, true, false, false, true},
+		BackupOptions{KeepWeekly: 3}.keep(created))
+	assert.Equal(t, []bool{true, false, true, true, false, false, true},
+		BackupOptions{KeepDaily: 3, KeepWeekly: 3}.keep(created))
+	assert.Equal(t, []bool{true, true, true, true, true, true, true}, BackupOptions{}.keep(created))
+	assert.Empty(t, BackupOptions{KeepDaily: 1}.keep(nil))
+}
+
+func Test_BackupRestore(t *testing.T) {
+	source, sourceDirectory, hash := newTestRepository(t)
+	_, err := source.CreateTag("v1.0", hash, &git.CreateTagOptions{Tagger: testSignature(), Message: "Release."})
+	assert.NoError(t, err)
+
+	repos := []RepositoryPair{{
+		Source:      Repository{RepositoryURL: sourceDirectory},
+		Destination: Repository{RepositoryURL: "https://example.com/org-1/repo-1"},
+	}}
+	backupDirectory := t.TempDir()
+	s := New(WithWorkingDirectory(t.TempDir()))
+	transports := []string{TransportGoGit}
+	if _, err = exec.LookPath("git"); err == nil {
+		transports = append(transports, TransportExec)
+	}
+	for _, transport := range transports {
+		for _, format := range []string{BackupFormatBundle, BackupFormatArchive} {
+			backupRepos := slices.Clone(repos)
+			backupRepos[0].Source.Transport = transport
+			result, backupErr := s.Backup(context.Background(), backupRepos, backupDirectory,
+				BackupOptions{Format: format, KeepDaily: 7})
+			assert.NoError(t, backupErr, transport+"/"+format)
+			manifestPath := result.Repositories[0].Snapshot
+			assert.Equal(t, filepath.Join(backupDirectory, "example.com_org-1_repo-1"), filepath.Dir(manifestPath))
+			manifest, manifestErr := ReadSnapshotManifest(manifestPath)
+			assert.NoError(t, manifestErr)
+			assert.Equal(t, format, manifest.Format)
+			assert.Len(t, manifest.Refs, 2)
+
+			destinationDirectory := filepath.Join(t.TempDir(), "restored.git")
+			restored := backupRepos[0]
+			restored.Destination.RepositoryURL = "file://" + destinationDirectory
+			_, restoreErr := s.Restore(context.Background(), manifestPath, restored)
+			assert.NoError(t, restoreErr)
+			destination, openErr := git.PlainOpen(destinationDirectory)
+			assert.NoError(t, openErr)
+			for name, refHash := range manifest.Refs {
+				ref, refErr := destination.Reference(gitplumbing.ReferenceName(name), false)
+				assert.NoError(t, refErr)
+				assert.Equal(t, refHash, ref.Hash().String())
+			}
+		}
+	}
+	// Only the newest snapshot of the day is retained.
+	manifests, err := filepath.Glob(filepath.Join(backupDirectory, "*", "*.json"))
+	assert.NoError(t, err)
+	assert.Len(t, manifests, 1)
+	files, err := os.ReadDir(filepath.Dir(manifests[0]))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	// Corrupted snapshots are not restored.
+	manifest, err := ReadSnapshotManifest(manifests[0])
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(manifests[0]), manifest.File), []byte("corrupted"), 0600))
+	result, err := s.Restore(context.Background(), manifests[0], repos[0])
+	assert.Error(t, err)
+	assert.Len(t, result.Errors(), 1)
+}
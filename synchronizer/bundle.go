@@ -0,0 +1,567 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	git "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	gitplumbing "github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/revlist"
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/sirupsen/logrus"
+)
+
+const bundleSignature = "# v2 git bundle\n"
+const bundleV3Signature = "# v3 git bundle\n"
+
+// Number of objects considered as delta bases when writing bundles.
+const bundlePackWindow = 10
+
+// BundleManifest describes a git bundle exported from the source repository of a repository pair.
+type BundleManifest struct {
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Created     time.Time `json:"created"`
+	// Name of the bundle file, in the same directory as the manifest.
+	Bundle string `json:"bundle"`
+	SHA256 string `json:"sha256"`
+	// Hashes of branches and tags in the bundle, keyed by ref name.
+	Refs map[string]string `json:"refs"`
+	// Commits which are not included in the bundle and have to be present in the destination repository.
+	// Empty for full bundles.
+	Prerequisites []string `json:"prerequisites,omitempty"`
+}
+
+var bundleNameReplacer = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// bundleName returns the base name of bundle and manifest files of repositoryPair. Names are derived
+// from destination repositories, which are unique, and followed by the time of the export.
+func bundleName(repositoryPair RepositoryPair) string {
+	name := repositoryPair.Destination.RepositoryURL
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+3:]
+	}
+	return strings.Trim(bundleNameReplacer.ReplaceAllString(name, "_"), "_.")
+}
+
+// ExportBundles writes a git bundle and a manifest listing its refs to directory for each repositoryPair.
+// Bundles only contain objects which have not been exported before, unless full is true. Earlier bundles
+// are kept, as incremental bundles depend on them, until a full bundle of the repository pair is written.
+func (s *Syncer) ExportBundles(ctx context.Context, repos []RepositoryPair, directory string,
+	full bool) (Result, error) {
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return Result{}, err
+	}
+	return s.run(ctx, repos, "Exporting", operationExport, func(ctx context.Context, messages chan MirrorStatus,
+		repositoryPair RepositoryPair, previous *RepositoryState) {
+		if full {
+			previous = nil
+		}
+		s.exportBundle(ctx, messages, repositoryPair, previous, directory)
+	})
+}
+
+// ImportBundles pushes branches and tags from bundles in directory, written by ExportBundles, to the destination
+// repository of each repositoryPair. All bundles written since the last full bundle are unpacked in the order of
+// export, so that bundles which have not been imported before are not missed. Branches and tags not present
+// in the latest bundle are removed from the destination in the same way as by Mirror.
+func (s *Syncer) ImportBundles(ctx context.Context, repos []RepositoryPair, directory string) (Result, error) {
+	return s.run(ctx, repos, "Importing", operationMirror, func(ctx context.Context, messages chan MirrorStatus,
+		repositoryPair RepositoryPair, _ *RepositoryState) {
+		s.importBundle(ctx, messages, repositoryPair, directory)
+	})
+}
+
+// exportBundle clones the source repository of repositoryPair and writes its bundle to directory. Objects
+// reachable from the refs exported previously are not included in the bundle.
+func (s *Syncer) exportBundle(ctx context.Context, messages chan MirrorStatus, repositoryPair RepositoryPair,
+	previous *RepositoryState, directory string) {
+	source, destination := repositoryPair.Source.RepositoryURL, repositoryPair.Destination.RepositoryURL
+	var allErrors []SyncError
+	status := MirrorStatus{Source: source, Destination: destination}
+	defer func() {
+		status.Errors = allErrors
+		status.Cancelled = ctx.Err() != nil
+		if status.LastCloneEnd.IsZero() {
+			status.LastCloneEnd = time.Now()
+		}
+		s.progress.Finished(status)
+		messages <- status
+	}()
+
+	repositoryLog := s.logger.WithFields(logrus.Fields{"source": source, "destination": destination})
+	s.progress.Phase(source, destination, PhaseCloning, 0, 0)
+	cloneStart := time.Now()
+	gitDirectory, err := os.MkdirTemp(s.workingDirectory, "")
+	if err != nil {
+		ProcessError(repositoryLog.WithField("phase", "clone"), err, "creating temporary directory for ", source,
+			&allErrors)
+		return
+	}
+	defer os.RemoveAll(gitDirectory)
+	repository, _, _ := s.cloneSource(ctx, gitDirectory, repositoryPair, repositoryLog, &allErrors)
+	if repository == nil {
+		return
+	}
+	status.CloneDuration = time.Since(cloneStart)
+	status.LastCloneEnd = time.Now()
+
+	exportLog := repositoryLog.WithField("phase", "export")
+	refs := make(map[string]string)
+	addPushedRefs(repository, refBranchPrefix, refs)
+	addPushedRefs(repository, refTagPrefix, refs)
+	var prerequisites []gitplumbing.Hash
+	if previous != nil {
+		prerequisites = bundlePrerequisites(repository, previous.ExportedRefs)
+	}
+	manifest := BundleManifest{Source: source, Destination: destination, Created: time.Now().UTC(), Refs: refs}
+	manifest.Bundle = bundleName(repositoryPair) + "." + manifest.Created.Format(snapshotTimeFormat) + ".bundle"
+	for _, hash := range prerequisites {
+		manifest.Prerequisites = append(manifest.Prerequisites, hash.String())
+	}
+	if err = writeBundleFiles(repository, manifest, prerequisites, directory); err != nil {
+		ProcessError(exportLog, err, "exporting bundle of ", source, &allErrors)
+		return
+	}
+	exportLog.WithFields(logrus.Fields{"refs": len(refs), "prerequisites": len(prerequisites)}).
+		Info("Exported bundle ", filepath.Join(directory, manifest.Bundle), ".")
+	status.ExportedRefs = refs
+	if len(prerequisites) == 0 {
+		if err = removeEarlierBundles(directory, repositoryPair, manifest, exportLog); err != nil {
+			ProcessError(exportLog, err, "removing earlier bundles of ", source, &allErrors)
+		}
+	}
+}
+
+// bundleManifestPaths returns paths of manifests of all bundles of repositoryPair in directory, in the order
+// in which the bundles have been exported.
+func bundleManifestPaths(directory string, repositoryPair RepositoryPair) ([]string, error) {
+	name := bundleName(repositoryPair)
+	candidates, err := filepath.Glob(filepath.Join(directory, name+".*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var manifestPaths []string
+	for _, candidate := range candidates {
+		created := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(candidate), name+"."), ".json")
+		if _, err := time.Parse(snapshotTimeFormat, created); err == nil {
+			manifestPaths = append(manifestPaths, candidate)
+		}
+	}
+	sort.Strings(manifestPaths)
+	return manifestPaths, nil
+}
+
+// removeEarlierBundles removes bundles of repositoryPair exported before the full bundle described by manifest.
+func removeEarlierBundles(directory string, repositoryPair RepositoryPair, manifest BundleManifest,
+	logger *logrus.Entry) error {
+	manifestPaths, err := bundleManifestPaths(directory, repositoryPair)
+	if err != nil {
+		return err
+	}
+	latest := strings.TrimSuffix(manifest.Bundle, ".bundle") + ".json"
+	for _, manifestPath := range manifestPaths {
+		if filepath.Base(manifestPath) >= latest {
+			continue
+		}
+		logger.Debug("Removing bundle ", manifestPath, " superseded by a full bundle.")
+		bundlePath := strings.TrimSuffix(manifestPath, ".json") + ".bundle"
+		if err = os.Remove(bundlePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err = os.Remove(manifestPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bundlePrerequisites returns commits pointed to by previously exported refs which are present in repository.
+func bundlePrerequisites(repository *git.Repository, exportedRefs map[string]string) []gitplumbing.Hash {
+	seen := make(map[gitplumbing.Hash]bool)
+	var prerequisites []gitplumbing.Hash
+	for _, exported := range exportedRefs {
+		hash := gitplumbing.NewHash(exported)
+		// Tags are peeled, as prerequisites have to be commits.
+		for {
+			tag, err := repository.TagObject(hash)
+			if err != nil {
+				break
+			}
+			hash = tag.Target
+		}
+		if _, err := repository.CommitObject(hash); err != nil || seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		prerequisites = append(prerequisites, hash)
+	}
+	sort.Slice(prerequisites, func(i, j int) bool { return prerequisites[i].String() < prerequisites[j].String() })
+	return prerequisites
+}
+
+// writeBundle writes a git bundle with refs and objects reachable from them, except the ones reachable
+// from prerequisites, to w.
+func writeBundle(w io.Writer, repository *git.Repository, refs map[string]string,
+	prerequisites []gitplumbing.Hash) error {
+	var header strings.Builder
+	header.WriteString(bundleSignature)
+	for _, hash := range prerequisites {
+		header.WriteString("-" + hash.String() + "\n")
+	}
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var wants []gitplumbing.Hash
+	for _, name := range names {
+		header.WriteString(refs[name] + " " + name + "\n")
+		wants = append(wants, gitplumbing.NewHash(refs[name]))
+	}
+	header.WriteString("\n")
+	if _, err := io.WriteString(w, header.String()); err != nil {
+		return err
+	}
+	objects, err := revlist.Objects(repository.Storer, wants, prerequisites)
+	if err != nil {
+		return err
+	}
+	_, err = packfile.NewEncoder(w, repository.Storer, false).Encode(objects, bundlePackWindow)
+	return err
+}
+
+// writeBundleFiles writes the bundle described by manifest and then the manifest itself to directory.
+// Both files are replaced atomically, so that an interrupted export does not leave an inconsistent pair.
+func writeBundleFiles(repository *git.Repository, manifest BundleManifest, prerequisites []gitplumbing.Hash,
+	directory string) error {
+	checksum := sha256.New()
+	err := writeFileAtomically(filepath.Join(directory, manifest.Bundle), func(w io.Writer) error {
+		return writeBundle(io.MultiWriter(w, checksum), repository, manifest.Refs, prerequisites)
+	})
+	if err != nil {
+		return err
+	}
+	manifest.SHA256 = hex.EncodeToString(checksum.Sum(nil))
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestName := strings.TrimSuffix(manifest.Bundle, ".bundle") + ".json"
+	return writeFileAtomically(filepath.Join(directory, manifestName), func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeFileAtomically replaces filePath with the contents written by write.
+func writeFileAtomically(filePath string, write func(io.Writer) error) error {
+	temporaryFile, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporaryFile.Name())
+	buffered := bufio.NewWriter(temporaryFile)
+	if err = write(buffered); err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		temporaryFile.Close()
+		return err
+	}
+	if err = temporaryFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporaryFile.Name(), filePath)
+}
+
+// ReadBundleManifests reads manifests of the bundles of repositoryPair from directory, starting from the latest
+// full bundle, in the order in which the bundles have been exported.
+func ReadBundleManifests(directory string, repositoryPair RepositoryPair) ([]BundleManifest, error) {
+	manifestPaths, err := bundleManifestPaths(directory, repositoryPair)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifestPaths) == 0 {
+		return nil, fmt.Errorf("no bundle of %s in %s: %w", repositoryPair.Destination.RepositoryURL, directory,
+			os.ErrNotExist)
+	}
+	var manifests []BundleManifest
+	for i := len(manifestPaths) - 1; i >= 0; i-- {
+		var manifest BundleManifest
+		data, err := os.ReadFile(manifestPaths[i])
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", manifestPaths[i], err)
+		}
+		manifests = append([]BundleManifest{manifest}, manifests...)
+		if len(manifest.Prerequisites) == 0 {
+			break
+		}
+	}
+	return manifests, nil
+}
+
+// ReadBundleManifest reads the manifest of the latest bundle of repositoryPair from directory.
+func ReadBundleManifest(directory string, repositoryPair RepositoryPair) (BundleManifest, error) {
+	manifests, err := ReadBundleManifests(directory, repositoryPair)
+	if err != nil {
+		return BundleManifest{}, err
+	}
+	return manifests[len(manifests)-1], nil
+}
+
+// readBundleHeader reads refs and prerequisites from the header of a git bundle. r is left at the beginning
+// of the packfile.
+func readBundleHeader(r *bufio.Reader) (map[string]string, []gitplumbing.Hash, error) {
+	signature, err := r.ReadString('\n')
+	if err != nil {
+		return nil, nil, err
+	}
+	if signature != bundleSignature && signature != bundleV3Signature {
+		return nil, nil, errors.New("not a git bundle")
+	}
+	refs := make(map[string]string)
+	var prerequisites []gitplumbing.Hash
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return refs, prerequisites, nil
+		case strings.HasPrefix(line, "@"):
+			// Capabilities of version 3 bundles.
+			if line != "@object-format=sha1" {
+				return nil, nil, errors.New("unsupported bundle capability " + line)
+			}
+		case strings.HasPrefix(line, "-"):
+			hash, _, _ := strings.Cut(line[1:], " ")
+			prerequisites = append(prerequisites, gitplumbing.NewHash(hash))
+		default:
+			hash, name, found := strings.Cut(line, " ")
+			if !found {
+				return nil, nil, errors.New("malformed bundle header line " + line)
+			}
+			refs[name] = hash
+		}
+	}
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 checksum of the file.
+func fileSHA256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	checksum := sha256.New()
+	if _, err = io.Copy(checksum, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(checksum.Sum(nil)), nil
+}
+
+// fetchDestinationObjects fetches objects reachable from branches and tags of the destination repository into
+// repository, so that prerequisites of incremental bundles, which include commits pointed to by tags, are available.
+func (s *Syncer) fetchDestinationObjects(ctx context.Context, repository *git.Repository,
+	repositoryPair RepositoryPair, logger *logrus.Entry) error {
+	remote := git.NewRemote(repository.Storer, &gitconfig.RemoteConfig{
+		Name: "destination", URLs: []string{repositoryPair.Destination.RepositoryURL},
+	})
+	fetchOptions, err := GetFetchOptions("+refs/heads/*:refs/remotes/destination/*", repositoryPair.Destination)
+	if err != nil {
+		return err
+	}
+	fetchOptions.RefSpecs = append(fetchOptions.RefSpecs, "+refs/tags/*:refs/remotes/destination-tags/*")
+	fetchOptions.Tags = git.NoTags
+	timeout := repositoryPair.Retry.GetTransferTimeout()
+	nextAttempt := attemptLogger(logger)
+	err = backoff.Retry(
+		func() error {
+			attemptLog := nextAttempt()
+			operationCtx, cancel := s.operationContext(ctx, timeout)
+			defer cancel()
+			fetchOptions.Progress = s.transferProgress(attemptLog)
+			err := remote.FetchContext(operationCtx, fetchOptions)
+			if err == nil || err == git.NoErrAlreadyUpToDate || isPermanentListError(err) {
+				return backoff.Permanent(err)
+			}
+			attemptLog.WithError(err).Warn("Retrying fetching branches and tags.")
+			return err
+		},
+		repositoryPair.Retry.NewBackOff(ctx, defaultLongMaxElapsedTime),
+	)
+	if err == git.NoErrAlreadyUpToDate || errors.Is(err, gittransport.ErrEmptyRemoteRepository) {
+		return nil
+	}
+	return err
+}
+
+// importBundle pushes branches and tags from the bundle of repositoryPair in directory to its destination.
+func (s *Syncer) importBundle(ctx context.Context, messages chan MirrorStatus, repositoryPair RepositoryPair,
+	directory string) {
+	source, destination := repositoryPair.Source.RepositoryURL, repositoryPair.Destination.RepositoryURL
+	var allErrors []SyncError
+	status := MirrorStatus{Source: source, Destination: destination, Refs: make(map[string]string)}
+	defer func() {
+		status.Errors = allErrors
+		status.Cancelled = ctx.Err() != nil
+		if status.LastCloneEnd.IsZero() {
+			status.LastCloneEnd = time.Now()
+		}
+		s.progress.Finished(status)
+		messages <- status
+	}()
+
+	repositoryLog := s.logger.WithFields(logrus.Fields{"source": source, "destination": destination})
+	importLog := repositoryLog.WithField("phase", "import")
+	s.progress.Phase(source, destination, PhaseFetching, 0, 0)
+	importStart := time.Now()
+	gitDirectory, err := os.MkdirTemp(s.workingDirectory, "")
+	if err != nil {
+		ProcessError(importLog, err, "creating temporary directory for ", destination, &allErrors)
+		return
+	}
+	defer os.RemoveAll(gitDirectory)
+	repository, refs, err := s.readBundle(ctx, gitDirectory, repositoryPair, directory, importLog)
+	if err != nil {
+		ProcessError(importLog, err, "importing bundle for ", destination, &allErrors)
+		return
+	}
+	sourceBranchList, sourceTagList, err := setReferences(repository, refs)
+	if err != nil {
+		ProcessError(importLog, err, "importing bundle for ", destination, &allErrors)
+		return
+	}
+	status.CloneDuration = time.Since(importStart)
+	status.LastCloneEnd = time.Now()
+	pushStart := time.Now()
+	defer func() { status.PushDuration = time.Since(pushStart) }()
+
+	s.pushRepository(ctx, repository, repositoryPair, sourceBranchList, sourceTagList, repositoryLog, &status,
+		&allErrors)
+}
+
+// setReferences creates refs with the given hashes in repository and returns the names of branches and tags.
+func setReferences(repository *git.Repository, refs map[string]string) ([]string, []string, error) {
+	var refList []*gitplumbing.Reference
+	for name, hash := range refs {
+		ref := gitplumbing.NewHashReference(gitplumbing.ReferenceName(name), gitplumbing.NewHash(hash))
+		if err := repository.Storer.SetReference(ref); err != nil {
+			return nil, nil, err
+		}
+		refList = append(refList, ref)
+	}
+	branches, tags := splitBranchesAndTags(refList)
+	return branches, tags, nil
+}
+
+// verifyChecksum returns an error if the SHA-256 checksum of the file is not the expected one.
+func verifyChecksum(filePath, expected string) error {
+	checksum, err := fileSHA256(filePath)
+	if err != nil {
+		return err
+	}
+	if checksum != expected {
+		return fmt.Errorf("checksum of %s does not match the manifest", filePath)
+	}
+	return nil
+}
+
+// readBundle verifies the bundles of repositoryPair in directory, starting from the latest full bundle, against
+// their manifests and unpacks them into a new repository in gitDirectory. Refs from the latest bundle are returned.
+func (s *Syncer) readBundle(ctx context.Context, gitDirectory string, repositoryPair RepositoryPair,
+	directory string, logger *logrus.Entry) (*git.Repository, map[string]string, error) {
+	manifests, err := ReadBundleManifests(directory, repositoryPair)
+	if err != nil {
+		return nil, nil, err
+	}
+	if source := manifests[len(manifests)-1].Source; source != repositoryPair.Source.RepositoryURL {
+		logger.Warn("Bundle has been exported from a different source repository: ", source)
+	}
+	repository, err := git.PlainInit(gitDirectory, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	var refs map[string]string
+	for i, manifest := range manifests {
+		bundlePath := filepath.Join(directory, manifest.Bundle)
+		if err = verifyChecksum(bundlePath, manifest.SHA256); err != nil {
+			return nil, nil, err
+		}
+		logger.Debug("Unpacking bundle ", bundlePath, ".")
+		if refs, err = s.unpackBundle(ctx, repository, repositoryPair, bundlePath, i == 0, logger); err != nil {
+			return nil, nil, err
+		}
+	}
+	return repository, refs, nil
+}
+
+// unpackBundle unpacks objects from the bundle into repository. If fetch is true, objects of the destination
+// repository of repositoryPair are fetched first if the bundle is incremental. Otherwise, prerequisites have to be
+// unpacked from the previous bundles. Refs from the bundle are returned, but not created in the repository.
+func (s *Syncer) unpackBundle(ctx context.Context, repository *git.Repository, repositoryPair RepositoryPair,
+	bundlePath string, fetch bool, logger *logrus.Entry) (map[string]string, error) {
+	bundleFile, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	defer bundleFile.Close()
+	reader := bufio.NewReader(bundleFile)
+	refs, prerequisites, err := readBundleHeader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", bundlePath, err)
+	}
+
+	if fetch && len(prerequisites) > 0 {
+		logger.Info("Fetching prerequisites of incremental bundle from the destination repository.")
+		if err = s.fetchDestinationObjects(ctx, repository, repositoryPair, logger); err != nil {
+			return nil, err
+		}
+	}
+	for _, hash := range prerequisites {
+		if repository.Storer.HasEncodedObject(hash) != nil {
+			return nil, fmt.Errorf("commit %s required by incremental bundle is missing in the destination "+
+				"repository, transfer the previous bundles or export a full bundle", hash)
+		}
+	}
+	if err = packfile.UpdateObjectStorage(repository.Storer, reader); err != nil {
+		return nil, fmt.Errorf("unpacking %s: %w", bundlePath, err)
+	}
+	return refs, nil
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	git "github.com/go-git/go-git/v5"
+	gitplumbing "github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_bundleName(t *testing.T) {
+	for url, name := range map[string]string{
+		"https://example.com/org-1/repo-1.git": "example.com_org-1_repo-1.git",
+		"file:///srv/backup/repo-1":            "srv_backup_repo-1",
+		"git@example.com:org/repo":             "git_example.com_org_repo",
+	} {
+		assert.Equal(t, name, bundleName(RepositoryPair{Destination: Repository{RepositoryURL: url}}), url)
+	}
+}
+
+func Test_ExportImportBundles(t *testing.T) {
+	source, sourceDirectory, first := newTestRepository(t)
+	commit := func() gitplumbing.Hash {
+		return commitTestRepository(t, source, git.CommitOptions{})
+	}
+	feature := gitplumbing.NewHashReference(gitplumbing.NewBranchReferenceName("feature"), first)
+	assert.NoError(t, source.Storer.SetReference(feature))
+
+	destinationDirectory := filepath.Join(t.TempDir(), "repo.git")
+	repos := []RepositoryPair{{
+		Source:      Repository{RepositoryURL: sourceDirectory},
+		Destination: Repository{RepositoryURL: "file://" + destinationDirectory},
+	}}
+	bundleDirectory := t.TempDir()
+	exporter := New(WithWorkingDirectory(t.TempDir()))
+	importer := New(WithWorkingDirectory(t.TempDir()))
+	exportAndImport := func() BundleManifest {
+		_, exportErr := exporter.ExportBundles(context.Background(), repos, bundleDirectory, false)
+		assert.NoError(t, exportErr)
+		_, importErr := importer.ImportBundles(context.Background(), repos, bundleDirectory)
+		assert.NoError(t, importErr)
+		manifest, manifestErr := ReadBundleManifest(bundleDirectory, repos[0])
+		assert.NoError(t, manifestErr)
+		return manifest
+	}
+
+	manifest := exportAndImport()
+	assert.Empty(t, manifest.Prerequisites)
+	assert.Equal(t, map[string]string{
+		"refs/heads/feature": first.String(), "refs/heads/master": first.String(),
+	}, manifest.Refs)
+	destination, err := git.PlainOpen(destinationDirectory)
+	assert.NoError(t, err)
+	_, err = destination.Reference(feature.Name(), false)
+	assert.NoError(t, err)
+
+	// The second bundle only contains objects which have not been exported before.
+	second := commit()
+	_, err = source.CreateTag("v1.0", second, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, source.Storer.RemoveReference(feature.Name()))
+	manifest = exportAndImport()
+	assert.Equal(t, []string{first.String()}, manifest.Prerequisites)
+	if gitPath, lookErr := exec.LookPath("git"); lookErr == nil {
+		output, verifyErr := exec.Command(gitPath, "-C", destinationDirectory, "bundle", "verify",
+			filepath.Join(bundleDirectory, manifest.Bundle)).CombinedOutput()
+		assert.NoError(t, verifyErr, string(output))
+	}
+	master, err := destination.Reference(gitplumbing.NewBranchReferenceName("master"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, second, master.Hash())
+	_, err = destination.Reference(gitplumbing.NewTagReferenceName("v1.0"), false)
+	assert.NoError(t, err)
+	_, err = destination.Reference(feature.Name(), false)
+	assert.ErrorIs(t, err, gitplumbing.ErrReferenceNotFound)
+
+	// Bundles of unchanged repositories contain no objects.
+	manifest = exportAndImport()
+	assert.Equal(t, []string{second.String()}, manifest.Prerequisites)
+
+	// Bundles which have not been imported are unpacked together with the next ones.
+	third := commit()
+	_, err = exporter.ExportBundles(context.Background(), repos, bundleDirectory, false)
+	assert.NoError(t, err)
+	fourth := commit()
+	manifest = exportAndImport()
+	assert.ElementsMatch(t, []string{second.String(), third.String()}, manifest.Prerequisites)
+	master, err = destination.Reference(gitplumbing.NewBranchReferenceName("master"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, fourth, master.Hash())
+	manifests, err := ReadBundleManifests(bundleDirectory, repos[0])
+	assert.NoError(t, err)
+	assert.Len(t, manifests, 5)
+	assert.Empty(t, manifests[0].Prerequisites)
+
+	// Lost destination repositories are restored starting from the full bundle.
+	assert.NoError(t, os.RemoveAll(destinationDirectory))
+	_, err = importer.ImportBundles(context.Background(), repos, bundleDirectory)
+	assert.NoError(t, err)
+
+	// Incremental bundles cannot be imported if the destination lacks their prerequisites.
+	assert.NoError(t, os.RemoveAll(destinationDirectory))
+	fullBundle := filepath.Join(bundleDirectory, manifests[0].Bundle)
+	assert.NoError(t, os.Remove(fullBundle))
+	assert.NoError(t, os.Remove(strings.TrimSuffix(fullBundle, ".bundle")+".json"))
+	result, err := importer.ImportBundles(context.Background(), repos, bundleDirectory)
+	assert.Error(t, err)
+	assert.Len(t, result.Errors(), 1)
+
+	// Full bundles replace earlier bundles.
+	_, err = exporter.ExportBundles(context.Background(), repos, bundleDirectory, true)
+	assert.NoError(t, err)
+	manifests, err = ReadBundleManifests(bundleDirectory, repos[0])
+	assert.NoError(t, err)
+	assert.Len(t, manifests, 1)
+	files, err := os.ReadDir(bundleDirectory)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	// Prerequisites reachable only from tags are fetched from the destination repository.
+	_, err = importer.ImportBundles(context.Background(), repos, bundleDirectory)
+	assert.NoError(t, err)
+	hotfix := commit()
+	_, err = source.CreateTag("v0.9.1", hotfix, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, source.Storer.SetReference(
+		gitplumbing.NewHashReference(gitplumbing.NewBranchReferenceName("master"), fourth)))
+	exportAndImport()
+	commit()
+	manifest = exportAndImport()
+	assert.Contains(t, manifest.Prerequisites, hotfix.String())
+	manifests, err = ReadBundleManifests(bundleDirectory, repos[0])
+	assert.NoError(t, err)
+	for _, earlier := range manifests[:len(manifests)-1] {
+		earlierBundle := filepath.Join(bundleDirectory, earlier.Bundle)
+		assert.NoError(t, os.Remove(earlierBundle))
+		assert.NoError(t, os.Remove(strings.TrimSuffix(earlierBundle, ".bundle")+".json"))
+	}
+	_, err = importer.ImportBundles(context.Background(), repos, bundleDirectory)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/sirupsen/logrus"
+)
+
+const checkStatusOK = "ok"
+const checkStatusEmpty = "ok (empty)"
+const checkStatusAuthRequired = "auth required"
+const checkStatusMissing = "missing"
+const checkStatusCreated = "missing (will be created)"
+
+// CheckStatus contains the result of pre-flight check of a single repository pair.
+type CheckStatus struct {
+	Source            string
+	Destination       string
+	SourceStatus      string
+	DestinationStatus string
+}
+
+// OK returns true if source can be read and destination can be pushed to.
+func (s CheckStatus) OK() bool {
+	return (s.SourceStatus == checkStatusOK || s.SourceStatus == checkStatusEmpty) &&
+		(s.DestinationStatus == checkStatusOK || s.DestinationStatus == checkStatusEmpty ||
+			s.DestinationStatus == checkStatusCreated)
+}
+
+// GetCheckStatus converts the error returned while listing refs into a short status description.
+func GetCheckStatus(err error) string {
+	switch {
+	case err == nil:
+		return checkStatusOK
+	case errors.Is(err, gittransport.ErrEmptyRemoteRepository):
+		return checkStatusEmpty
+	case errors.Is(err, gittransport.ErrAuthenticationRequired), errors.Is(err, gittransport.ErrAuthorizationFailed):
+		return checkStatusAuthRequired
+	case errors.Is(err, gittransport.ErrRepositoryNotFound):
+		return checkStatusMissing
+	default:
+		return "error: " + err.Error()
+	}
+}
+
+// CheckRepository verifies that the source repository can be read and that the destination repository
+// can be pushed to. Refs are only listed, nothing is cloned.
+func (s *Syncer) CheckRepository(ctx context.Context, repositoryPair RepositoryPair) CheckStatus {
+	source, destination := repositoryPair.Source.RepositoryURL, repositoryPair.Destination.RepositoryURL
+	status := CheckStatus{Source: source, Destination: destination}
+	repositoryLog := s.logger.WithFields(logrus.Fields{"source": source, "destination": destination})
+
+	_, _, err := s.GetBranchesAndTagsFromRemote(ctx, repositoryPair.Source, repositoryPair.Retry, repositoryLog)
+	status.SourceStatus = GetCheckStatus(err)
+
+	_, _, err = s.GetBranchesAndTagsForPush(ctx, repositoryPair.Destination, repositoryPair.Retry, repositoryLog)
+	status.DestinationStatus = GetCheckStatus(err)
+	if IsLocalRepository(destination) {
+		// Local destination repositories are created during synchronization.
+		if _, statErr := os.Stat(localRepositoryPath(destination)); errors.Is(statErr, os.ErrNotExist) {
+			status.DestinationStatus = checkStatusCreated
+		}
+	}
+	return status
+}
+
+// Check checks connectivity and permissions for each repositoryPair and returns
+// the results in the same order as repos.
+func (s *Syncer) Check(ctx context.Context, repos []RepositoryPair) []CheckStatus {
+	results := make([]CheckStatus, len(repos))
+	var wg sync.WaitGroup
+	for i, repository := range repos {
+		s.logger.WithFields(logrus.Fields{
+			"source": repository.Source.RepositoryURL, "destination": repository.Destination.RepositoryURL,
+		}).Debug("Checking repository.")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = s.CheckRepository(ctx, repository)
+		}()
+	}
+	wg.Wait()
+	return results
+}
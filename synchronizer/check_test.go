@@ -0,0 +1,41 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synchronizer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GetCheckStatus(t *testing.T) {
+	assert.Equal(t, "ok", GetCheckStatus(nil))
+	assert.Equal(t, "ok (empty)", GetCheckStatus(gittransport.ErrEmptyRemoteRepository))
+	assert.Equal(t, "auth required", GetCheckStatus(gittransport.ErrAuthenticationRequired))
+	assert.Equal(t, "auth required", GetCheckStatus(gittransport.ErrAuthorizationFailed))
+	assert.Equal(t, "missing", GetCheckStatus(gittransport.ErrRepositoryNotFound))
+	// Errors of the exec transport wrap the go-git ones.
+	assert.Equal(t, "auth required", GetCheckStatus(gitCommandError("ls-remote",
+		[]string{"fatal: Authentication failed for 'https://example.com/'"}, errors.New("exit status 128"))))
+	assert.Equal(t, "missing", GetCheckStatus(fmt.Errorf("listing refs: %w", gittransport.ErrRepositoryNotFound)))
+	assert.Equal(t, "error: timeout", GetCheckStatus(errors.New("timeout")))
+	assert.True(t, CheckStatus{SourceStatus: "ok", DestinationStatus: "ok (empty)"}.OK())
+	assert.False(t, CheckStatus{SourceStatus: "ok", DestinationStatus: "auth required"}.OK())
+}
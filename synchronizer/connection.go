@@ -0,0 +1,173 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// TLSSettings configures TLS connections to a repository served over HTTPS.
+type TLSSettings struct {
+	// Path of a PEM file with CA certificates trusted in addition to the system ones.
+	CABundle string `mapstructure:"ca_bundle" yaml:"ca_bundle"`
+	// Paths of PEM files with the client certificate and its key used for mutual TLS authentication.
+	ClientCert string `mapstructure:"client_cert" yaml:"client_cert"`
+	ClientKey  string `mapstructure:"client_key" yaml:"client_key"`
+	// If true, certificates of the server are not verified. Only meant for testing. If not set, the default
+	// setting is used, so a repository can set it to false to verify certificates despite the defaults.
+	InsecureSkipVerify *bool `mapstructure:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+}
+
+// SkipVerify returns true if certificates of the server are not verified.
+func (s TLSSettings) SkipVerify() bool {
+	return s.InsecureSkipVerify != nil && *s.InsecureSkipVerify
+}
+
+// connectionOptions are the proxy and TLS settings of a repository, with the files they refer to read.
+type connectionOptions struct {
+	caBundle        []byte
+	clientCert      []byte
+	clientKey       []byte
+	insecureSkipTLS bool
+	proxy           gittransport.ProxyOptions
+}
+
+// SetRepositoryConnectionSettings ensures that repositories for which the proxy, TLS and transport settings
+// have not been set, use the default ones from config file.
+func SetRepositoryConnectionSettings(repositories *[]RepositoryPair, defaultSettings RepositoryPair) {
+	for i := 0; i < len(*repositories); i++ {
+		(*repositories)[i].Source.setConnectionSettings(defaultSettings.Source)
+		(*repositories)[i].Destination.setConnectionSettings(defaultSettings.Destination)
+	}
+}
+
+func (r *Repository) setConnectionSettings(defaultSettings Repository) {
+	if r.Proxy == "" {
+		r.Proxy = defaultSettings.Proxy
+	}
+	if r.TLS.CABundle == "" {
+		r.TLS.CABundle = defaultSettings.TLS.CABundle
+	}
+	if r.TLS.ClientCert == "" && r.TLS.ClientKey == "" {
+		r.TLS.ClientCert = defaultSettings.TLS.ClientCert
+		r.TLS.ClientKey = defaultSettings.TLS.ClientKey
+	}
+	if r.TLS.InsecureSkipVerify == nil {
+		r.TLS.InsecureSkipVerify = defaultSettings.TLS.InsecureSkipVerify
+	}
+	if r.Transport == "" {
+		r.Transport = defaultSettings.Transport
+	}
+}
+
+// connectionOptions reads the files referred to by the TLS settings of the repository.
+func (r Repository) connectionOptions() (connectionOptions, error) {
+	options := connectionOptions{
+		insecureSkipTLS: r.TLS.SkipVerify(),
+		proxy:           gittransport.ProxyOptions{URL: r.Proxy},
+	}
+	if (r.TLS.ClientCert == "") != (r.TLS.ClientKey == "") {
+		return options, errors.New("client certificate and client key must be set together")
+	}
+	for _, f := range []struct {
+		path string
+		data *[]byte
+	}{
+		{r.TLS.CABundle, &options.caBundle},
+		{r.TLS.ClientCert, &options.clientCert},
+		{r.TLS.ClientKey, &options.clientKey},
+	} {
+		if f.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return options, err
+		}
+		*f.data = data
+	}
+	return options, nil
+}
+
+// setEndpoint applies the options to endpoint, in the same way as go-git does for clone, fetch and push options.
+func (o connectionOptions) setEndpoint(endpoint *gittransport.Endpoint) {
+	endpoint.CaBundle = o.caBundle
+	endpoint.ClientCert = o.clientCert
+	endpoint.ClientKey = o.clientKey
+	endpoint.InsecureSkipTLS = o.insecureSkipTLS
+	endpoint.Proxy = o.proxy
+}
+
+// ValidateConnectionSettings checks that the proxy URL is valid and that the files referred to
+// by the TLS settings contain certificates and keys.
+func (r Repository) ValidateConnectionSettings() error {
+	if r.Proxy != "" {
+		proxyURL, err := url.Parse(r.Proxy)
+		if err != nil {
+			return err
+		}
+		if proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return errors.New("proxy URL " + r.Proxy + " must include scheme and host")
+		}
+	}
+	_, err := r.httpTransport()
+	return err
+}
+
+// httpTransport returns HTTP transport using the proxy and TLS settings of the repository.
+// Without a proxy set, proxy environment variables are used.
+func (r Repository) httpTransport() (*http.Transport, error) {
+	options, err := r.connectionOptions()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if r.Proxy != "" {
+		proxyURL, proxyErr := url.Parse(r.Proxy)
+		if proxyErr != nil {
+			return nil, proxyErr
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	// #nosec G402 -- skipping verification has to be requested explicitly and is documented as insecure.
+	tlsConfig := &tls.Config{InsecureSkipVerify: options.insecureSkipTLS, MinVersion: tls.VersionTLS12}
+	if len(options.caBundle) > 0 {
+		rootCAs, poolErr := x509.SystemCertPool()
+		if poolErr != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(options.caBundle) {
+			return nil, errors.New("no certificates found in CA bundle " + r.TLS.CABundle)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if len(options.clientCert) > 0 {
+		certificate, certErr := tls.X509KeyPair(options.clientCert, options.clientKey)
+		if certErr != nil {
+			return nil, certErr
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
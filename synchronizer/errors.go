@@ -0,0 +1,163 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// ErrorKind classifies errors encountered while synchronizing repositories.
+type ErrorKind string
+
+const (
+	ErrorAuth            ErrorKind = "auth"
+	ErrorNotFound        ErrorKind = "not-found"
+	ErrorNetwork         ErrorKind = "network"
+	ErrorRejectedPush    ErrorKind = "rejected-push"
+	ErrorProtectedBranch ErrorKind = "protected-branch"
+	ErrorDeletionBlocked ErrorKind = "deletion-blocked"
+	ErrorMovedTag        ErrorKind = "moved-tag"
+	ErrorSignature       ErrorKind = "unverified-signature"
+	ErrorOther           ErrorKind = "other"
+)
+
+// ErrorKinds lists all kinds of errors.
+var ErrorKinds = []ErrorKind{
+	ErrorAuth, ErrorNotFound, ErrorNetwork, ErrorRejectedPush, ErrorProtectedBranch, ErrorDeletionBlocked,
+	ErrorMovedTag, ErrorSignature, ErrorOther,
+}
+
+// SyncError describes an error encountered while synchronizing a repository pair.
+type SyncError struct {
+	Kind ErrorKind `json:"kind"`
+	// Phase of synchronization (clone, list, fetch, push, delete) and ref being processed, if any.
+	Phase   string `json:"phase,omitempty"`
+	Ref     string `json:"ref,omitempty"`
+	Message string `json:"message"`
+	// Underlying error. It is not preserved in the synchronization state.
+	Err error `json:"-"`
+}
+
+func (e SyncError) Error() string {
+	return e.Message
+}
+
+func (e SyncError) Unwrap() error {
+	return e.Err
+}
+
+// pushRejectedMarkers are contained in errors returned when the server refuses to update a ref.
+var pushRejectedMarkers = []string{"command error on", "unpack error", "rejected", "declined", "denied", "prohibited"}
+
+// networkMarkers are contained in errors caused by network problems, including the ones printed by git.
+var networkMarkers = []string{
+	"connection", "timeout", "no such host", "could not resolve host", "failed to connect", "tls",
+}
+
+// ClassifyError determines the kind of err encountered in phase of synchronization.
+func ClassifyError(err error, phase string) ErrorKind {
+	switch {
+	case errors.Is(err, gittransport.ErrAuthenticationRequired), errors.Is(err, gittransport.ErrAuthorizationFailed):
+		return ErrorAuth
+	case errors.Is(err, gittransport.ErrRepositoryNotFound):
+		return ErrorNotFound
+	case errors.Is(err, ErrMovedTag):
+		return ErrorMovedTag
+	case errors.Is(err, ErrUnverifiedSignature):
+		return ErrorSignature
+	}
+	message := strings.ToLower(err.Error())
+	if errors.Is(err, git.ErrForceNeeded) || containsAny(message, pushRejectedMarkers) {
+		switch {
+		case strings.Contains(message, "protected"):
+			return ErrorProtectedBranch
+		case phase == "delete":
+			return ErrorDeletionBlocked
+		default:
+			return ErrorRejectedPush
+		}
+	}
+	var netError net.Error
+	if errors.As(err, &netError) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) || containsAny(message, networkMarkers) {
+		return ErrorNetwork
+	}
+	return ErrorOther
+}
+
+// isPushRejected returns true if err means that the destination refused to update a ref.
+func isPushRejected(err error) bool {
+	kind := ClassifyError(err, "")
+	return kind == ErrorRejectedPush || kind == ErrorProtectedBranch
+}
+
+// Maximum size of messages from the server collected by remoteMessageWriter.
+const maxRemoteMessagesSize = 4096
+
+// remoteMessageWriter collects messages sent by the git server over the progress channel,
+// omitting transfer progress.
+type remoteMessageWriter struct {
+	messages []string
+	size     int
+}
+
+func (w *remoteMessageWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.FieldsFunc(string(p), func(r rune) bool { return r == '\r' || r == '\n' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.Contains(line, "%") || w.size+len(line) > maxRemoteMessagesSize {
+			continue
+		}
+		w.messages = append(w.messages, line)
+		w.size += len(line)
+	}
+	return len(p), nil
+}
+
+// wrap adds messages from the server to err.
+func (w *remoteMessageWriter) wrap(err error) error {
+	if len(w.messages) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w (remote: %s)", err, strings.Join(w.messages, " "))
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+// newSyncError returns SyncError for err encountered while performing activity on url.
+func newSyncError(err error, activity, url, phase, ref string) SyncError {
+	return SyncError{
+		Kind:    ClassifyError(err, phase),
+		Phase:   phase,
+		Ref:     ref,
+		Message: fmt.Sprintf("Error while %s%s: %s", activity, url, err),
+		Err:     err,
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ClassifyError(t *testing.T) {
+	assert.Equal(t, ErrorAuth, ClassifyError(gittransport.ErrAuthorizationFailed, "push"))
+	assert.Equal(t, ErrorNotFound, ClassifyError(gittransport.ErrRepositoryNotFound, "clone"))
+	assert.Equal(t, ErrorNetwork, ClassifyError(context.DeadlineExceeded, "fetch"))
+	assert.Equal(t, ErrorNetwork, ClassifyError(errors.New("read: connection reset by peer"), "clone"))
+	assert.Equal(t, ErrorRejectedPush,
+		ClassifyError(errors.New("command error on refs/heads/main: pre-receive hook declined"), "push"))
+	assert.Equal(t, ErrorProtectedBranch,
+		ClassifyError(errors.New("command error on refs/heads/main: protected branch hook declined"), "push"))
+	assert.Equal(t, ErrorDeletionBlocked,
+		ClassifyError(errors.New("command error on refs/heads/old: deletion prohibited"), "delete"))
+	assert.Equal(t, ErrorOther, ClassifyError(errors.New("reference not found"), "list"))
+}
+
+func Test_remoteMessageWriter(t *testing.T) {
+	w := &remoteMessageWriter{}
+	_, _ = w.Write([]byte("Resolving deltas:  50% (1/2)\rResolving deltas: 100% (2/2), done.\n"))
+	_, _ = w.Write([]byte("GitLab: You are not allowed to force push code to a protected branch on this project.\n"))
+	err := w.wrap(errors.New("command error on refs/heads/main: pre-receive hook declined"))
+	assert.EqualError(t, err, "command error on refs/heads/main: pre-receive hook declined "+
+		"(remote: GitLab: You are not allowed to force push code to a protected branch on this project.)")
+	assert.Equal(t, ErrorProtectedBranch, ClassifyError(err, "push"))
+	assert.True(t, isPushRejected(err))
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RepositoryFilter selects a subset of repository pairs. Repository pairs are selected if they match
+// all non-empty criteria and none of the Exclude patterns. The zero value selects all repository pairs.
+type RepositoryFilter struct {
+	// Patterns matched against source and destination URLs, in which * matches any sequence of characters
+	// (including /) and ? matches any single character, e.g. https://gitlab.example.com/org-5/*.
+	Only    []string
+	Exclude []string
+	// Repository pairs having any of the labels are selected.
+	Labels []string
+	// Repository pairs are selected by their name, or the last element of their source or destination URL.
+	Names []string
+}
+
+// SetRepositoryLabels ensures that repositories for which the labels have not been set,
+// use the default ones from config file.
+func SetRepositoryLabels(repositories *[]RepositoryPair, defaultSettings RepositoryPair) {
+	for i := 0; i < len(*repositories); i++ {
+		if (*repositories)[i].Labels == nil {
+			(*repositories)[i].Labels = defaultSettings.Labels
+		}
+	}
+}
+
+// ErrBadPattern is returned for patterns with an unterminated character class or a trailing backslash.
+var ErrBadPattern = errors.New("syntax error in pattern")
+
+// compilePattern converts pattern to a regular expression. Patterns are used for URLs as well as for branch
+// and tag names: * matches any sequence of characters (including /), ? matches any single character,
+// [...] matches a character class as in path.Match, and \ escapes the following character.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	var expression strings.Builder
+	expression.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			expression.WriteString(".*")
+		case '?':
+			expression.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, ErrBadPattern
+			}
+			expression.WriteString(pattern[i : i+end+2])
+			i += end + 1
+		case '\\':
+			if i+1 == len(pattern) {
+				return nil, ErrBadPattern
+			}
+			i++
+			expression.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			expression.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expression.WriteString("$")
+	compiled, err := regexp.Compile(expression.String())
+	if err != nil {
+		return nil, ErrBadPattern
+	}
+	return compiled, nil
+}
+
+// ValidatePattern returns an error if pattern is malformed.
+func ValidatePattern(pattern string) error {
+	_, err := compilePattern(pattern)
+	return err
+}
+
+// matchPattern returns true if value matches pattern. Malformed patterns match nothing.
+func matchPattern(pattern, value string) bool {
+	compiled, err := compilePattern(pattern)
+	return err == nil && compiled.MatchString(value)
+}
+
+// matchesAny returns true if the source or destination URL of repositoryPair matches any of the patterns.
+func (p RepositoryPair) matchesAny(patterns []string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, p.Source.RepositoryURL) || matchPattern(pattern, p.Destination.RepositoryURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasName returns true if name is the name of repositoryPair or the last element of its source
+// or destination URL.
+func (p RepositoryPair) hasName(name string) bool {
+	return name == p.Name || name == repositoryName(p.Source.RepositoryURL) ||
+		name == repositoryName(p.Destination.RepositoryURL)
+}
+
+// Matches returns true if repositoryPair is selected by the filter.
+func (f RepositoryFilter) Matches(repositoryPair RepositoryPair) bool {
+	if len(f.Only) > 0 && !repositoryPair.matchesAny(f.Only) {
+		return false
+	}
+	if repositoryPair.matchesAny(f.Exclude) {
+		return false
+	}
+	if len(f.Labels) > 0 && !slices.ContainsFunc(f.Labels, func(label string) bool {
+		return slices.Contains(repositoryPair.Labels, label)
+	}) {
+		return false
+	}
+	return len(f.Names) == 0 || slices.ContainsFunc(f.Names, repositoryPair.hasName)
+}
+
+// Apply returns the repository pairs selected by the filter. An error is returned if any of the names
+// does not belong to any of the repository pairs, or if no repository pair is selected.
+func (f RepositoryFilter) Apply(repositories []RepositoryPair) ([]RepositoryPair, error) {
+	var allErrors []error
+	for _, name := range f.Names {
+		if !slices.ContainsFunc(repositories, func(p RepositoryPair) bool { return p.hasName(name) }) {
+			allErrors = append(allErrors, errors.New("repository "+name+" not found in configuration"))
+		}
+	}
+	if len(allErrors) > 0 {
+		return nil, errors.Join(allErrors...)
+	}
+	var selected []RepositoryPair
+	for _, repositoryPair := range repositories {
+		if f.Matches(repositoryPair) {
+			selected = append(selected, repositoryPair)
+		}
+	}
+	if len(selected) == 0 && len(repositories) > 0 {
+		return nil, errors.New("no repositories match the given criteria")
+	}
+	return selected, nil
+}
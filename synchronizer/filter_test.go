@@ -0,0 +1,95 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_matchPattern(t *testing.T) {
+	assert.True(t, matchPattern("https://gitlab.example.com/org-5/*", "https://gitlab.example.com/org-5/group/repo-1"))
+	assert.True(t, matchPattern("*/repo-?", "https://gitlab.example.com/org-5/repo-1"))
+	assert.True(t, matchPattern("*repo-1.git", "https://gitlab.example.com/org-5/repo-1.git"))
+	assert.False(t, matchPattern("*repo-1", "https://gitlab.example.com/org-5/repo-10"))
+	assert.False(t, matchPattern("https://gitlab.example.com/org-5/repo-1", "https://gitlab.example.com/org-5/repo-10"))
+	assert.False(t, matchPattern("https://gitlab.example.com/org.5/*", "https://gitlab.example.com/org-5/repo-1"))
+	assert.True(t, matchPattern("internal/*", "internal/team/ci"))
+	assert.True(t, matchPattern("release/[0-9]*", "release/1.0"))
+	assert.False(t, matchPattern("release/[^0-9]*", "release/1.0"))
+	assert.True(t, matchPattern(`feature\*`, "feature*"))
+	assert.False(t, matchPattern(`feature\*`, "feature-1"))
+	assert.False(t, matchPattern("release/[", "release/["))
+	assert.ErrorIs(t, ValidatePattern("release/["), ErrBadPattern)
+	assert.ErrorIs(t, ValidatePattern(`release\`), ErrBadPattern)
+	assert.NoError(t, ValidatePattern("release/[0-9]*"))
+}
+
+func Test_RepositoryFilter_Apply(t *testing.T) {
+	repositories := []RepositoryPair{
+		{
+			Source:      Repository{RepositoryURL: "https://github.example.com/org-1/repo-1"},
+			Destination: Repository{RepositoryURL: "https://gitlab.example.com/org-5/repo-1.git"},
+			Labels:      []string{"team-a"},
+		},
+		{
+			Name:        "repo-2",
+			Source:      Repository{RepositoryURL: "https://github.example.com/org-2/repo-2"},
+			Destination: Repository{RepositoryURL: "https://gitlab.example.com/org-5/archive"},
+			Labels:      []string{"team-b", "critical"},
+		},
+		{
+			Source:      Repository{RepositoryURL: "https://github.example.com/org-2/repo-3"},
+			Destination: Repository{RepositoryURL: "https://gitlab.example.com/org-6/repo-3"},
+		},
+	}
+	for _, tc := range []struct {
+		filter   RepositoryFilter
+		selected []int
+	}{
+		{RepositoryFilter{}, []int{0, 1, 2}},
+		{RepositoryFilter{Only: []string{"https://gitlab.example.com/org-5/*"}}, []int{0, 1}},
+		{RepositoryFilter{Only: []string{"*/org-2/*"}, Exclude: []string{"*/archive"}}, []int{2}},
+		{RepositoryFilter{Labels: []string{"critical", "team-a"}}, []int{0, 1}},
+		{RepositoryFilter{Labels: []string{"team-b"}, Only: []string{"*/org-1/*"}}, nil},
+		{RepositoryFilter{Names: []string{"repo-1", "repo-2"}}, []int{0, 1}},
+		{RepositoryFilter{Names: []string{"archive"}, Exclude: []string{"*/repo-3"}}, []int{1}},
+	} {
+		var expected []RepositoryPair
+		for _, i := range tc.selected {
+			expected = append(expected, repositories[i])
+		}
+		selected, err := tc.filter.Apply(repositories)
+		if expected == nil {
+			assert.EqualError(t, err, "no repositories match the given criteria")
+		} else {
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, expected, selected, tc.filter)
+	}
+	_, err := RepositoryFilter{Names: []string{"repo-1", "repo-4", "repo-5"}}.Apply(repositories)
+	assert.EqualError(t, err, "repository repo-4 not found in configuration\n"+
+		"repository repo-5 not found in configuration")
+}
+
+func Test_SetRepositoryLabels(t *testing.T) {
+	repositories := []RepositoryPair{{}, {Labels: []string{"team-b"}}, {Labels: []string{}}}
+	SetRepositoryLabels(&repositories, RepositoryPair{Labels: []string{"team-a"}})
+	assert.Equal(t, []string{"team-a"}, repositories[0].Labels)
+	assert.Equal(t, []string{"team-b"}, repositories[1].Labels)
+	assert.Equal(t, []string{}, repositories[2].Labels)
+}
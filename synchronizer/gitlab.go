@@ -0,0 +1,184 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const gitLabAPITimeout = 30 * time.Second
+
+// gitLabAccessLevel describes who is allowed to push to, merge into or unprotect a protected branch.
+type gitLabAccessLevel struct {
+	AccessLevel *int `json:"access_level,omitempty"`
+	UserID      *int `json:"user_id,omitempty"`
+	GroupID     *int `json:"group_id,omitempty"`
+	DeployKeyID *int `json:"deploy_key_id,omitempty"`
+}
+
+// gitLabProtectedBranch holds protection settings of a branch as returned by GitLab API.
+type gitLabProtectedBranch struct {
+	Name                      string              `json:"name"`
+	PushAccessLevels          []gitLabAccessLevel `json:"push_access_levels"`
+	MergeAccessLevels         []gitLabAccessLevel `json:"merge_access_levels"`
+	UnprotectAccessLevels     []gitLabAccessLevel `json:"unprotect_access_levels"`
+	AllowForcePush            bool                `json:"allow_force_push"`
+	CodeOwnerApprovalRequired bool                `json:"code_owner_approval_required"`
+}
+
+// gitLabAPIError is returned if GitLab API responds with an error status.
+type gitLabAPIError struct {
+	method     string
+	path       string
+	statusCode int
+	status     string
+	message    string
+}
+
+func (e *gitLabAPIError) Error() string {
+	return fmt.Sprintf("%s %s: %s %s", e.method, e.path, e.status, e.message)
+}
+
+// gitLabClient manages protected branches of a single GitLab project.
+type gitLabClient struct {
+	apiURL     string
+	project    string
+	token      string
+	httpClient *http.Client
+}
+
+// newGitLabClient returns client for the GitLab project of repository, using its proxy and TLS settings.
+func newGitLabClient(repository Repository) (*gitLabClient, error) {
+	u, err := url.Parse(repository.RepositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	project := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if u.Host == "" || project == "" {
+		return nil, errors.New("cannot determine GitLab project from " + repository.RepositoryURL)
+	}
+	transport, err := repository.httpTransport()
+	if err != nil {
+		return nil, err
+	}
+	return &gitLabClient{u.Scheme + "://" + u.Host + "/api/v4", project, getPersonalAccessToken(repository.Auth),
+		&http.Client{Transport: transport}}, nil
+}
+
+func (c *gitLabClient) request(ctx context.Context, method, path string, body, result any) error {
+	var requestBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(ctx, method,
+		c.apiURL+"/projects/"+url.PathEscape(c.project)+path, requestBody)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("PRIVATE-TOKEN", c.token)
+	request.Header.Set("Content-Type", "application/json")
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return &gitLabAPIError{method, path, response.StatusCode, response.Status, strings.TrimSpace(string(message))}
+	}
+	if result != nil {
+		return json.NewDecoder(response.Body).Decode(result)
+	}
+	return nil
+}
+
+func (c *gitLabClient) getProtectedBranch(ctx context.Context, branch string) (gitLabProtectedBranch, error) {
+	var protection gitLabProtectedBranch
+	err := c.request(ctx, http.MethodGet, "/protected_branches/"+url.PathEscape(branch), nil, &protection)
+	return protection, err
+}
+
+func (c *gitLabClient) unprotectBranch(ctx context.Context, branch string) error {
+	return c.request(ctx, http.MethodDelete, "/protected_branches/"+url.PathEscape(branch), nil, nil)
+}
+
+// protectBranch restores protection previously returned by getProtectedBranch.
+func (c *gitLabClient) protectBranch(ctx context.Context, protection gitLabProtectedBranch) error {
+	return c.request(ctx, http.MethodPost, "/protected_branches", map[string]any{
+		"name":                         protection.Name,
+		"allowed_to_push":              protection.PushAccessLevels,
+		"allowed_to_merge":             protection.MergeAccessLevels,
+		"allowed_to_unprotect":         protection.UnprotectAccessLevels,
+		"allow_force_push":             protection.AllowForcePush,
+		"code_owner_approval_required": protection.CodeOwnerApprovalRequired,
+	}, nil)
+}
+
+// retryUnprotected retries operation on branch with the branch temporarily unprotected, if rejection returned
+// by the first attempt is a protected branch rejection and unprotecting is enabled for repositoryPair.
+// Otherwise, rejection is returned unchanged.
+func (s *Syncer) retryUnprotected(ctx context.Context, repositoryPair RepositoryPair, branch string,
+	logger *logrus.Entry, rejection error, operation func() error) error {
+	if rejection == nil || !repositoryPair.UnprotectBranches || ClassifyError(rejection, "") != ErrorProtectedBranch {
+		return rejection
+	}
+	client, err := newGitLabClient(repositoryPair.Destination)
+	if err != nil {
+		return errors.Join(rejection, err)
+	}
+	// Protection must be restored even if synchronization is cancelled in the meantime.
+	apiCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), gitLabAPITimeout)
+	defer cancel()
+	protection, err := client.getProtectedBranch(apiCtx, branch)
+	var apiErr *gitLabAPIError
+	if errors.As(err, &apiErr) && apiErr.statusCode == http.StatusNotFound {
+		// Only protections of the exact branch name can be read. Wildcard rules such as release/* protect
+		// other branches as well, so they are not removed.
+		logger.Warn("Branch is protected by a wildcard rule, which is not unprotected.")
+		return rejection
+	}
+	if err != nil {
+		return errors.Join(rejection, fmt.Errorf("reading protection of branch %s: %w", branch, err))
+	}
+	logger.Warn("Temporarily unprotecting branch.")
+	if err = client.unprotectBranch(apiCtx, branch); err != nil {
+		return errors.Join(rejection, fmt.Errorf("unprotecting branch %s: %w", branch, err))
+	}
+	err = operation()
+	protectCtx, cancelProtect := context.WithTimeout(context.WithoutCancel(ctx), gitLabAPITimeout)
+	defer cancelProtect()
+	if protectErr := client.protectBranch(protectCtx, protection); protectErr != nil {
+		logger.WithError(protectErr).Error("Re-protecting branch failed.")
+		return errors.Join(err, fmt.Errorf("re-protecting branch %s: %w", branch, protectErr))
+	}
+	logger.Info("Branch protection restored.")
+	return err
+}
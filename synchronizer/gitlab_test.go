@@ -0,0 +1,97 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_retryUnprotected(t *testing.T) {
+	t.Setenv("GITLAB_TOKEN", "gitlab-token")
+	var requests []string
+	var protectRequest string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gitlab-token", r.Header.Get("PRIVATE-TOKEN"))
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		switch {
+		case r.URL.EscapedPath() == "/api/v4/projects/group%2Fproject/protected_branches/release%2F1.0":
+			// The branch is protected by the release/* wildcard rule.
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"message": "404 Not found"}`)
+		case r.Method == http.MethodGet:
+			_, _ = io.WriteString(w, `{"name": "main", "push_access_levels": [{"access_level": 40,
+				"access_level_description": "Maintainers"}], "merge_access_levels": [{"access_level": 30}],
+				"unprotect_access_levels": [], "allow_force_push": false}`)
+		case r.Method == http.MethodPost:
+			body, _ := io.ReadAll(r.Body)
+			protectRequest = string(body)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	s := New()
+	pair := RepositoryPair{
+		Destination: Repository{
+			RepositoryURL: server.URL + "/group/project.git",
+			Auth:          Authentication{Method: AuthMethodToken, TokenName: "GITLAB_TOKEN"},
+		},
+	}
+	rejection := errors.New("command error on refs/heads/main: pre-receive hook declined " +
+		"(remote: GitLab: You are not allowed to force push code to a protected branch on this project.)")
+	pushed := false
+	push := func() error {
+		pushed = true
+		return nil
+	}
+
+	// Unprotecting branches is disabled.
+	err := s.retryUnprotected(context.Background(), pair, "main", logrus.WithField("ref", "main"), rejection, push)
+	assert.Equal(t, rejection, err)
+	assert.False(t, pushed)
+
+	pair.UnprotectBranches = true
+	err = s.retryUnprotected(context.Background(), pair, "main", logrus.WithField("ref", "main"), rejection, push)
+	assert.NoError(t, err)
+	assert.True(t, pushed)
+	assert.Equal(t, []string{
+		"GET /api/v4/projects/group%2Fproject/protected_branches/main",
+		"DELETE /api/v4/projects/group%2Fproject/protected_branches/main",
+		"POST /api/v4/projects/group%2Fproject/protected_branches",
+	}, requests)
+	assert.JSONEq(t, `{"name": "main", "allowed_to_push": [{"access_level": 40}],
+		"allowed_to_merge": [{"access_level": 30}], "allowed_to_unprotect": [], "allow_force_push": false,
+		"code_owner_approval_required": false}`, protectRequest)
+
+	// Wildcard protections are left unchanged and the original rejection is returned.
+	requests = nil
+	pushed = false
+	err = s.retryUnprotected(context.Background(), pair, "release/1.0", logrus.WithField("ref", "release/1.0"),
+		rejection, push)
+	assert.Equal(t, rejection, err)
+	assert.False(t, pushed)
+	assert.Equal(t, []string{"GET /api/v4/projects/group%2Fproject/protected_branches/release%2F1.0"}, requests)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const fileURLPrefix = "file://"
+
+// IsLocalRepository returns true if repositoryURL is a file:// URL, an absolute path,
+// or a path relative to the current directory starting with ./ or ../.
+func IsLocalRepository(repositoryURL string) bool {
+	return strings.HasPrefix(repositoryURL, fileURLPrefix) || filepath.IsAbs(repositoryURL) ||
+		strings.HasPrefix(repositoryURL, "./") || strings.HasPrefix(repositoryURL, "../")
+}
+
+// localRepositoryPath returns the filesystem path of local repositoryURL.
+func localRepositoryPath(repositoryURL string) string {
+	return filepath.FromSlash(strings.TrimPrefix(repositoryURL, fileURLPrefix))
+}
+
+// repositoryName returns the last element of repositoryURL without the .git suffix.
+func repositoryName(repositoryURL string) string {
+	name := strings.TrimRight(strings.ReplaceAll(repositoryURL, "\\", "/"), "/")
+	name = name[strings.LastIndex(name, "/")+1:]
+	return strings.TrimSuffix(name, ".git")
+}
+
+// createLocalDestination initializes a bare repository at repositoryURL if it is a local path
+// which does not exist yet.
+func createLocalDestination(repositoryURL string, logger *logrus.Entry) error {
+	if !IsLocalRepository(repositoryURL) {
+		return nil
+	}
+	repositoryPath := localRepositoryPath(repositoryURL)
+	if _, err := os.Stat(repositoryPath); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	logger.Info("Creating bare destination repository.")
+	_, err := git.PlainInit(repositoryPath, true)
+	return err
+}
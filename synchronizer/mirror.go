@@ -0,0 +1,654 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	git "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	gitplumbing "github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/sirupsen/logrus"
+)
+
+const refBranchPrefix = "refs/heads/"
+const refTagPrefix = "refs/tags/"
+const basicAuthUsername = "This can be any string."
+
+// MirrorStatus describes the outcome of synchronization of a single repository pair.
+type MirrorStatus struct {
+	Source        string
+	Destination   string
+	Errors        []SyncError
+	Cancelled     bool
+	LastCloneEnd  time.Time
+	CloneDuration time.Duration
+	PushDuration  time.Duration
+	// Hashes of branches and tags successfully pushed to the destination, keyed by ref name.
+	Refs map[string]string
+	// True if clone and push have been skipped because the source has not changed.
+	Skipped bool
+	// Branches and tags not present in the source repository which have not been removed from the destination
+	// because of the preserve patterns or additive mode.
+	PreservedRefs []string
+	// Tags present in the source repository, unless the tag policy is skip.
+	Tags []TagStatus
+	// Hashes of branches and tags written to the bundle, set only when exporting bundles.
+	ExportedRefs map[string]string
+	// Manifest of the snapshot written when backing up the source repository.
+	Snapshot string
+}
+
+// SetRepositoryAuth ensures that repositories for which the authentication settings have not been
+// overridden, use the default authentication settings from config file. Local repositories are accessed
+// without authentication, so the defaults do not apply to them.
+func SetRepositoryAuth(repositories *[]RepositoryPair, defaultSettings RepositoryPair) {
+	for i := 0; i < len(*repositories); i++ {
+		if (*repositories)[i].Source.Auth.Method == "" && !IsLocalRepository((*repositories)[i].Source.RepositoryURL) {
+			(*repositories)[i].Source.Auth.Method = defaultSettings.Source.Auth.Method
+			if (*repositories)[i].Source.Auth.Method == AuthMethodToken {
+				(*repositories)[i].Source.Auth.TokenName = defaultSettings.Source.Auth.TokenName
+			}
+		}
+		if (*repositories)[i].Destination.Auth.Method == "" &&
+			!IsLocalRepository((*repositories)[i].Destination.RepositoryURL) {
+			(*repositories)[i].Destination.Auth.Method = defaultSettings.Destination.Auth.Method
+			if (*repositories)[i].Destination.Auth.Method == AuthMethodToken {
+				(*repositories)[i].Destination.Auth.TokenName = defaultSettings.Destination.Auth.TokenName
+			}
+		}
+	}
+}
+
+// ValidateRepositories checks for common issues with input repository data from config file.
+func (s *Syncer) ValidateRepositories(repositories []RepositoryPair) error {
+	var allDestinationRepositories []string
+	for _, repo := range repositories {
+		if stringInSlice(repo.Destination.RepositoryURL, allDestinationRepositories) {
+			return errors.New(
+				"multiple repositories set to be synchronized to the same destination repository: " +
+					repo.Destination.RepositoryURL,
+			)
+		}
+		allDestinationRepositories = append(allDestinationRepositories, repo.Destination.RepositoryURL)
+		sourceProjectName := repositoryName(repo.Source.RepositoryURL)
+		destinationProjectName := repositoryName(repo.Destination.RepositoryURL)
+		if sourceProjectName != destinationProjectName {
+			s.logger.Warn(
+				"Source project name (", sourceProjectName,
+				") and destination project name (", destinationProjectName, ") differ!",
+			)
+		}
+	}
+	return nil
+}
+
+// isPermanentListError returns true if retrying listing refs with the same settings cannot succeed.
+func isPermanentListError(err error) bool {
+	return errors.Is(err, gittransport.ErrAuthenticationRequired) ||
+		errors.Is(err, gittransport.ErrAuthorizationFailed) || errors.Is(err, gittransport.ErrRepositoryNotFound) ||
+		errors.Is(err, gittransport.ErrEmptyRemoteRepository)
+}
+
+// attemptLogger returns a function which annotates logger with consecutive attempt numbers
+// each time it is called. It is meant to be called once per attempt of a retried operation.
+func attemptLogger(logger *logrus.Entry) func() *logrus.Entry {
+	attempt := 0
+	return func() *logrus.Entry {
+		attempt++
+		return logger.WithField("attempt", attempt)
+	}
+}
+
+// ListRemote lists refs present in repository and is retried in case of error.
+func (s *Syncer) ListRemote(ctx context.Context, repository Repository, timeout time.Duration,
+	logger *logrus.Entry) ([]*gitplumbing.Reference, error) {
+	operationCtx, cancel := s.operationContext(ctx, timeout)
+	defer cancel()
+	refList, err := repository.transport().list(operationCtx, repository)
+	switch {
+	case isPermanent(err):
+		return nil, err
+	case isPermanentListError(err):
+		return nil, backoff.Permanent(err)
+	case err != nil:
+		logger.WithError(err).Warn("Retrying listing remote.")
+	}
+	return refList, err
+}
+
+// GetBranchesAndTagsFromRemote returns list of branches and tags present in repository.
+func (s *Syncer) GetBranchesAndTagsFromRemote(ctx context.Context, repository Repository,
+	retryPolicy RetryPolicy, logger *logrus.Entry) ([]string, []string, error) {
+	timeout := retryPolicy.GetListTimeout()
+	nextAttempt := attemptLogger(logger.WithField("phase", "list"))
+	refList, err := backoff.RetryWithData(
+		func() ([]*gitplumbing.Reference, error) {
+			return s.ListRemote(ctx, repository, timeout, nextAttempt())
+		},
+		retryPolicy.NewBackOff(ctx, defaultShortMaxElapsedTime),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	branchList, tagList := splitBranchesAndTags(refList)
+	return branchList, tagList, nil
+}
+
+// advertisedReferences returns refs advertised by git-upload-pack of repository, or by git-receive-pack
+// if forPush is true.
+func (s *Syncer) advertisedReferences(ctx context.Context, repository Repository, forPush bool,
+	timeout time.Duration, logger *logrus.Entry) (*packp.AdvRefs, error) {
+	operationCtx, cancel := s.operationContext(ctx, timeout)
+	defer cancel()
+	advertisedRefs, err := repository.transport().advertise(operationCtx, repository, forPush)
+	switch {
+	case isPermanent(err):
+		return nil, err
+	case isPermanentListError(err):
+		return nil, backoff.Permanent(err)
+	case err != nil:
+		logger.WithError(err).Warn("Retrying listing remote.")
+		return nil, err
+	}
+	return advertisedRefs, nil
+}
+
+// ListRemoteForPush lists refs advertised by git-receive-pack of repository. As opposed to ListRemote,
+// this requires permissions to push to the repository.
+func (s *Syncer) ListRemoteForPush(ctx context.Context, repository Repository,
+	timeout time.Duration, logger *logrus.Entry) ([]*gitplumbing.Reference, error) {
+	advertisedRefs, err := s.advertisedReferences(ctx, repository, true, timeout, logger)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := advertisedRefs.AllReferences()
+	if err != nil {
+		return nil, backoff.Permanent(err)
+	}
+	var refList []*gitplumbing.Reference
+	for _, ref := range refs {
+		refList = append(refList, ref)
+	}
+	return refList, nil
+}
+
+// GetBranchesAndTagsForPush returns list of branches and tags present in repository,
+// provided that its authentication settings allow pushing to it.
+func (s *Syncer) GetBranchesAndTagsForPush(ctx context.Context, repository Repository,
+	retryPolicy RetryPolicy, logger *logrus.Entry) ([]string, []string, error) {
+	timeout := retryPolicy.GetListTimeout()
+	nextAttempt := attemptLogger(logger.WithField("phase", "list"))
+	refList, err := backoff.RetryWithData(
+		func() ([]*gitplumbing.Reference, error) {
+			return s.ListRemoteForPush(ctx, repository, timeout, nextAttempt())
+		},
+		retryPolicy.NewBackOff(ctx, defaultShortMaxElapsedTime),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	branchList, tagList := splitBranchesAndTags(refList)
+	return branchList, tagList, nil
+}
+
+// splitBranchesAndTags returns sorted lists of branch and tag names from refList.
+func splitBranchesAndTags(refList []*gitplumbing.Reference) ([]string, []string) {
+	var branchList []string
+	var tagList []string
+	for _, ref := range refList {
+		refName := ref.Name().String()
+		if strings.HasPrefix(refName, refBranchPrefix) {
+			branchName := strings.TrimPrefix(refName, refBranchPrefix)
+			branchList = append(branchList, branchName)
+		} else if strings.HasPrefix(refName, refTagPrefix) {
+			tagName := strings.TrimPrefix(refName, refTagPrefix)
+			tagList = append(tagList, tagName)
+		}
+	}
+	sort.Strings(branchList)
+	sort.Strings(tagList)
+	return branchList, tagList
+}
+
+// ProcessError classifies err and appends it to allErrors. Phase and ref are taken from logger fields.
+func ProcessError(logger *logrus.Entry, err error, activity string, url string, allErrors *[]SyncError) {
+	if err == nil || err == git.NoErrAlreadyUpToDate {
+		return
+	}
+	phase, _ := logger.Data["phase"].(string)
+	ref, _ := logger.Data["ref"].(string)
+	syncError := newSyncError(err, activity, url, phase, ref)
+	logger.WithError(err).WithField("kind", syncError.Kind).Error("Error while " + activity + url + ".")
+	*allErrors = append(*allErrors, syncError)
+}
+
+// getPersonalAccessToken returns the token for the given authentication settings.
+// Unknown authentication methods are reported by configuration validation before synchronization starts.
+func getPersonalAccessToken(auth Authentication) string {
+	if auth.Method == AuthMethodToken {
+		return os.Getenv(auth.TokenName)
+	}
+	return ""
+}
+
+// getAuth returns authentication method for repository, or nil if no token has been configured for it.
+func getAuth(auth Authentication) gittransport.AuthMethod {
+	pat := getPersonalAccessToken(auth)
+	if pat == "" {
+		return nil
+	}
+	return &githttp.BasicAuth{Username: basicAuthUsername, Password: pat}
+}
+
+// GetCloneOptions returns clone options for source repository.
+func GetCloneOptions(source Repository) (*git.CloneOptions, error) {
+	connection, err := source.connectionOptions()
+	if err != nil {
+		return nil, err
+	}
+	return &git.CloneOptions{
+		URL:             source.RepositoryURL,
+		Auth:            getAuth(source.Auth),
+		CABundle:        connection.caBundle,
+		ClientCert:      connection.clientCert,
+		ClientKey:       connection.clientKey,
+		InsecureSkipTLS: connection.insecureSkipTLS,
+		ProxyOptions:    connection.proxy,
+	}, nil
+}
+
+// GetListOptions returns list options for source repository.
+func GetListOptions(source Repository) (*git.ListOptions, error) {
+	connection, err := source.connectionOptions()
+	if err != nil {
+		return nil, err
+	}
+	return &git.ListOptions{
+		Auth:            getAuth(source.Auth),
+		CABundle:        connection.caBundle,
+		ClientCert:      connection.clientCert,
+		ClientKey:       connection.clientKey,
+		InsecureSkipTLS: connection.insecureSkipTLS,
+		ProxyOptions:    connection.proxy,
+	}, nil
+}
+
+// GetFetchOptions returns fetch options for source repository.
+func GetFetchOptions(refSpec string, source Repository) (*git.FetchOptions, error) {
+	connection, err := source.connectionOptions()
+	if err != nil {
+		return nil, err
+	}
+	return &git.FetchOptions{
+		RefSpecs:        []gitconfig.RefSpec{gitconfig.RefSpec(refSpec)},
+		Auth:            getAuth(source.Auth),
+		CABundle:        connection.caBundle,
+		ClientCert:      connection.clientCert,
+		ClientKey:       connection.clientKey,
+		InsecureSkipTLS: connection.insecureSkipTLS,
+		ProxyOptions:    connection.proxy,
+	}, nil
+}
+
+// GetDestionationAuth returns authentication struct for destination git repository.
+func GetDestinationAuth(destAuth Authentication) *githttp.BasicAuth {
+	destinationAuth := &githttp.BasicAuth{
+		Username: basicAuthUsername,
+		Password: getPersonalAccessToken(destAuth),
+	}
+	return destinationAuth
+}
+
+// GitPlainClone clones source repository into gitDirectory and is retried in case of error.
+func (s *Syncer) GitPlainClone(ctx context.Context, gitDirectory string, source Repository,
+	timeout time.Duration, logger *logrus.Entry) (*git.Repository, error) {
+	operationCtx, cancel := s.operationContext(ctx, timeout)
+	defer cancel()
+	repository, err := source.transport().clone(operationCtx, gitDirectory, source, s.transferProgress(logger))
+	switch {
+	case isPermanent(err):
+		return nil, err
+	case errors.Is(err, gittransport.ErrAuthenticationRequired):
+		// Terminate backoff.
+		return nil, backoff.Permanent(err)
+	case err != nil:
+		logger.WithError(err).Warn("Retrying cloning repository.")
+	}
+	return repository, err
+}
+
+// GitFetchBranches fetches all branches from source repository and is retried in case of error.
+func (s *Syncer) GitFetchBranches(ctx context.Context, repository *git.Repository, source Repository,
+	timeout time.Duration, logger *logrus.Entry) error {
+	operationCtx, cancel := s.operationContext(ctx, timeout)
+	defer cancel()
+	err := source.transport().fetch(operationCtx, repository, source, "refs/heads/*:refs/heads/*",
+		s.transferProgress(logger))
+	switch {
+	case isPermanent(err):
+		return err
+	case errors.Is(err, gittransport.ErrAuthenticationRequired):
+		logger.Error("Authentication required.")
+		return backoff.Permanent(err)
+	case err == git.NoErrAlreadyUpToDate:
+		// Terminate backoff with no error in case the branch is already up-to-date.
+		// This can occur if source or destination repository has only one branch.
+		logger.Info("Repository up-to-date.")
+		return nil
+	case err != nil:
+		logger.WithError(err).Warn("Retrying fetching branches.")
+	}
+	return err
+}
+
+// PushRefs pushes refs defined in refSpecString to destination repository and is retried in case of error.
+func (s *Syncer) PushRefs(ctx context.Context, repository *git.Repository, destination Repository,
+	refSpecString string, timeout time.Duration, logger *logrus.Entry) error {
+	operationCtx, cancel := s.operationContext(ctx, timeout)
+	defer cancel()
+	err := destination.transport().push(operationCtx, repository, destination, refSpecString,
+		s.transferProgress(logger))
+	switch {
+	case isPermanent(err):
+		return err
+	case errors.Is(err, gittransport.ErrAuthenticationRequired), err == git.NoErrAlreadyUpToDate:
+		// Terminate backoff.
+		return backoff.Permanent(err)
+	case err != nil && isPushRejected(err):
+		// Retrying cannot help if the destination refuses to update the ref.
+		return backoff.Permanent(err)
+	case err != nil:
+		logger.WithError(err).Warn("Retrying pushing refs.")
+	}
+	return err
+}
+
+// addPushedRefs records hashes of local refs starting with prefix in refs.
+func addPushedRefs(repository *git.Repository, prefix string, refs map[string]string) {
+	iter, err := repository.References()
+	if err != nil {
+		return
+	}
+	_ = iter.ForEach(func(ref *gitplumbing.Reference) error {
+		if ref.Type() == gitplumbing.HashReference && strings.HasPrefix(ref.Name().String(), prefix) {
+			refs[ref.Name().String()] = ref.Hash().String()
+		}
+		return nil
+	})
+}
+
+// addPushedRef records the hash of the local ref with the given full name in refs.
+func addPushedRef(repository *git.Repository, name string, refs map[string]string) {
+	ref, err := repository.Reference(gitplumbing.ReferenceName(name), false)
+	if err == nil && ref.Type() == gitplumbing.HashReference {
+		refs[name] = ref.Hash().String()
+	}
+}
+
+// MirrorRepository mirrors branches and tags from source to destination. Tags and branches
+// no longer present in source are removed from destination. When ctx is cancelled, no further
+// operations are started and operations in progress are given a grace period to finish.
+func (s *Syncer) MirrorRepository(ctx context.Context, messages chan MirrorStatus, repositoryPair RepositoryPair) {
+	s.mirrorRepository(ctx, messages, repositoryPair, nil)
+}
+
+// mirrorRepository works like MirrorRepository, but skips clone and push if the source has not changed
+// since the previous successful synchronization.
+func (s *Syncer) mirrorRepository(ctx context.Context, messages chan MirrorStatus, repositoryPair RepositoryPair,
+	previous *RepositoryState) {
+	source, destination := repositoryPair.Source.RepositoryURL, repositoryPair.Destination.RepositoryURL
+	var allErrors []SyncError
+	status := MirrorStatus{Source: source, Destination: destination, Refs: make(map[string]string)}
+	// Deferred before removing the temporary directory, so that the status is sent after the cleanup.
+	defer func() {
+		status.Errors = allErrors
+		status.Cancelled = ctx.Err() != nil
+		if status.LastCloneEnd.IsZero() {
+			status.LastCloneEnd = time.Now()
+		}
+		s.progress.Finished(status)
+		messages <- status
+	}()
+
+	repositoryLog := s.logger.WithFields(logrus.Fields{"source": source, "destination": destination})
+	s.progress.Phase(source, destination, PhaseListing, 0, 0)
+	if s.sourceUnchanged(ctx, repositoryPair, previous, repositoryLog) {
+		repositoryLog.Info("Source has not changed since the last synchronization, skipping.")
+		status.Skipped = true
+		status.Refs = previous.Refs
+		return
+	}
+	s.progress.Phase(source, destination, PhaseCloning, 0, 0)
+	cloneStart := time.Now()
+	gitDirectory, err := os.MkdirTemp(s.workingDirectory, "")
+	if err != nil {
+		ProcessError(repositoryLog.WithField("phase", "clone"), err, "creating temporary directory for ", source,
+			&allErrors)
+		return
+	}
+	defer os.RemoveAll(gitDirectory)
+	repository, sourceBranchList, sourceTagList := s.cloneSource(ctx, gitDirectory, repositoryPair, repositoryLog,
+		&allErrors)
+	if repository == nil {
+		return
+	}
+
+	status.CloneDuration = time.Since(cloneStart)
+	status.LastCloneEnd = time.Now()
+	pushStart := time.Now()
+	defer func() { status.PushDuration = time.Since(pushStart) }()
+
+	s.pushRepository(ctx, repository, repositoryPair, sourceBranchList, sourceTagList, repositoryLog, &status,
+		&allErrors)
+}
+
+// cloneSource clones the source repository of repositoryPair into gitDirectory and fetches all its branches.
+// Lists of branches and tags present in the source repository are returned together with the local repository,
+// which is nil if any errors have been encountered.
+func (s *Syncer) cloneSource(ctx context.Context, gitDirectory string, repositoryPair RepositoryPair,
+	repositoryLog *logrus.Entry, allErrors *[]SyncError) (*git.Repository, []string, []string) {
+	source, destination := repositoryPair.Source.RepositoryURL, repositoryPair.Destination.RepositoryURL
+	retryPolicy := repositoryPair.Retry
+	cloneLog := repositoryLog.WithField("phase", "clone")
+	cloneLog.Debug("Cloning repository.")
+	timeout := retryPolicy.GetTransferTimeout()
+	nextCloneAttempt := attemptLogger(cloneLog)
+	repository, err := backoff.RetryWithData(
+		func() (*git.Repository, error) {
+			return s.GitPlainClone(ctx, gitDirectory, repositoryPair.Source, timeout, nextCloneAttempt())
+		},
+		retryPolicy.NewBackOff(ctx, defaultLongMaxElapsedTime),
+	)
+	if err != nil {
+		ProcessError(cloneLog, err, "cloning repository from ", source, allErrors)
+		return nil, nil, nil
+	}
+
+	sourceBranchList, sourceTagList, err := s.GetBranchesAndTagsFromRemote(
+		ctx, repositoryPair.Source, retryPolicy, repositoryLog,
+	)
+	if err != nil {
+		ProcessError(repositoryLog.WithField("phase", "list"), err, "getting branches and tags from ", source,
+			allErrors)
+		return nil, nil, nil
+	}
+	repositoryLog.WithFields(logrus.Fields{"branches": sourceBranchList, "tags": sourceTagList}).
+		Debug("Listed source branches and tags.")
+
+	fetchLog := repositoryLog.WithField("phase", "fetch")
+	fetchLog.Info("Fetching all branches.")
+	s.progress.Phase(source, destination, PhaseFetching, 0, 0)
+	nextFetchAttempt := attemptLogger(fetchLog)
+	err = backoff.Retry(
+		func() error {
+			return s.GitFetchBranches(ctx, repository, repositoryPair.Source, timeout, nextFetchAttempt())
+		},
+		retryPolicy.NewBackOff(ctx, defaultShortMaxElapsedTime),
+	)
+	if err != nil {
+		ProcessError(fetchLog, err, "fetching branches from ", source, allErrors)
+		return nil, nil, nil
+	}
+
+	return repository, sourceBranchList, sourceTagList
+}
+
+// pushRepository pushes branches and tags from the local repository to the destination repository
+// of repositoryPair, and removes the ones not present in sourceBranchList and sourceTagList from it.
+func (s *Syncer) pushRepository(ctx context.Context, repository *git.Repository, repositoryPair RepositoryPair,
+	sourceBranchList, sourceTagList []string, repositoryLog *logrus.Entry, status *MirrorStatus,
+	allErrors *[]SyncError) {
+	source, destination := repositoryPair.Source.RepositoryURL, repositoryPair.Destination.RepositoryURL
+	retryPolicy := repositoryPair.Retry
+	timeout := retryPolicy.GetTransferTimeout()
+	if ctx.Err() != nil {
+		return
+	}
+	if err := createLocalDestination(destination, repositoryLog); err != nil {
+		ProcessError(repositoryLog, err, "creating repository ", destination, allErrors)
+		return
+	}
+	destinationBranchList, destinationTagList, err := s.GetBranchesAndTagsFromRemote(
+		ctx, repositoryPair.Destination, retryPolicy, repositoryLog,
+	)
+	// Nothing has been pushed to the destination repository yet.
+	if errors.Is(err, gittransport.ErrEmptyRemoteRepository) {
+		err = nil
+	}
+	if err != nil {
+		ProcessError(repositoryLog.WithField("phase", "list"), err, "getting branches and tags from ", destination,
+			allErrors)
+	}
+	repositoryLog.WithFields(logrus.Fields{"branches": destinationBranchList, "tags": destinationTagList}).
+		Debug("Listed destination branches and tags.")
+
+	pushLog := repositoryLog.WithField("phase", "push")
+	var verifier *signatureVerifier
+	if repositoryPair.VerifySignatures.Enabled() {
+		verifier, err = newSignatureVerifier(repositoryPair.VerifySignatures)
+		if err != nil {
+			ProcessError(pushLog, err, "reading keys for verification of refs to be pushed to ", destination,
+				allErrors)
+			return
+		}
+	}
+
+	if repositoryPair.TagsOnly {
+		// Neither push nor remove any branches.
+		sourceBranchList, destinationBranchList = nil, nil
+	} else {
+		pushLog.Info("Pushing all branches.")
+	}
+	for i, branch := range sourceBranchList {
+		if ctx.Err() != nil {
+			return
+		}
+		s.progress.Phase(source, destination, PhasePushingBranches, i, len(sourceBranchList))
+		branchLog := pushLog.WithField("ref", refBranchPrefix+branch)
+		if err = verifier.verifyBranch(repository, repositoryPair.VerifySignatures, branch); err != nil {
+			ProcessError(branchLog, err, "verifying signature of branch "+branch+" to be pushed to ", destination,
+				allErrors)
+			continue
+		}
+		branchLog.Debug("Pushing branch.")
+		nextPushAttempt := attemptLogger(branchLog)
+		pushBranch := func() error {
+			return backoff.Retry(
+				func() error {
+					return s.PushRefs(
+						ctx, repository, repositoryPair.Destination, "+"+refBranchPrefix+branch+":"+refBranchPrefix+branch,
+						timeout, nextPushAttempt(),
+					)
+				},
+				retryPolicy.NewBackOff(ctx, defaultLongMaxElapsedTime),
+			)
+		}
+		err = pushBranch()
+		err = s.retryUnprotected(ctx, repositoryPair, branch, branchLog, err, pushBranch)
+		ProcessError(branchLog, err, "pushing branch "+branch+" to ", destination, allErrors)
+		if err == nil || err == git.NoErrAlreadyUpToDate {
+			addPushedRef(repository, refBranchPrefix+branch, status.Refs)
+		}
+	}
+
+	// Remove any branches not present in the source repository anymore, unless they are preserved.
+	deleteLog := repositoryLog.WithField("phase", "delete")
+	branchesToDelete := repositoryPair.refsToDelete(
+		destinationBranchList, sourceBranchList, refBranchPrefix, &status.PreservedRefs, deleteLog,
+	)
+	for i, branch := range branchesToDelete {
+		if ctx.Err() != nil {
+			return
+		}
+		s.progress.Phase(source, destination, PhaseDeletingBranches, i, len(branchesToDelete))
+		branchLog := deleteLog.WithField("ref", refBranchPrefix+branch)
+		branchLog.Info("Removing branch.")
+		nextRemoveAttempt := attemptLogger(branchLog)
+		removeBranch := func() error {
+			return backoff.Retry(
+				func() error {
+					return s.PushRefs(
+						ctx, repository, repositoryPair.Destination, ":"+refBranchPrefix+branch, timeout, nextRemoveAttempt(),
+					)
+				},
+				retryPolicy.NewBackOff(ctx, defaultShortMaxElapsedTime),
+			)
+		}
+		err = s.retryUnprotected(ctx, repositoryPair, branch, branchLog, removeBranch(), removeBranch)
+		ProcessError(branchLog, err, "removing branch "+branch+" from ", destination, allErrors)
+	}
+
+	if ctx.Err() != nil || repositoryPair.TagPolicy == TagPolicySkip {
+		return
+	}
+	s.progress.Phase(source, destination, PhasePushingTags, 0, 0)
+	status.Tags = s.pushTags(
+		ctx, repository, repositoryPair, verifier, timeout, pushLog, status, allErrors,
+	)
+
+	// Remove any tags not present in the source repository anymore, unless they are preserved.
+	tagsToDelete := repositoryPair.refsToDelete(
+		destinationTagList, sourceTagList, refTagPrefix, &status.PreservedRefs, deleteLog,
+	)
+	for i, tag := range tagsToDelete {
+		if ctx.Err() != nil {
+			return
+		}
+		s.progress.Phase(source, destination, PhaseDeletingTags, i, len(tagsToDelete))
+		tagLog := deleteLog.WithField("ref", refTagPrefix+tag)
+		tagLog.Info("Removing tag.")
+		nextRemoveAttempt := attemptLogger(tagLog)
+		err = backoff.Retry(
+			func() error {
+				return s.PushRefs(
+					ctx, repository, repositoryPair.Destination, ":"+refTagPrefix+tag, timeout, nextRemoveAttempt(),
+				)
+			},
+			retryPolicy.NewBackOff(ctx, defaultShortMaxElapsedTime),
+		)
+		ProcessError(tagLog, err, "removing tag "+tag+" from ", destination, allErrors)
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synchronizer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	gitplumbing "github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SetRepositoryAuth(t *testing.T) {
+	repositories := []RepositoryPair{
+		{
+			Source: Repository{
+				RepositoryURL: "https://example.com/org-1/repo-1",
+				Auth:          Authentication{"", ""},
+			},
+			Destination: Repository{
+				RepositoryURL: "https://example.com/org-2/repo-2",
+				Auth:          Authentication{"", ""},
+			},
+		},
+		{
+			Source: Repository{
+				RepositoryURL: "https://example.com/org-3/repo-3",
+				Auth:          Authentication{"token", "CUSTOM_TOKEN_1"},
+			},
+			Destination: Repository{
+				RepositoryURL: "https://example.com/org-4/repo-4",
+				Auth:          Authentication{"token", "CUSTOM_TOKEN_2"},
+			},
+		},
+		{
+			Source:      Repository{RepositoryURL: "https://example.com/org-5/repo-5", Auth: Authentication{"", ""}},
+			Destination: Repository{RepositoryURL: "/srv/backup/repo-5.git", Auth: Authentication{"", ""}},
+		},
+	}
+	defaultSettings := RepositoryPair{
+		Source: Repository{
+			RepositoryURL: "", Auth: Authentication{"token", "GITLAB_TOKEN"},
+		},
+		Destination: Repository{
+			RepositoryURL: "", Auth: Authentication{"token", "GITHUB_TOKEN"},
+		},
+	}
+	SetRepositoryAuth(&repositories, defaultSettings)
+	assert.Equal(t, repositories[0].Source.Auth.Method, "token")
+	assert.Equal(t, repositories[0].Source.Auth.TokenName, "GITLAB_TOKEN")
+	assert.Equal(t, repositories[0].Destination.Auth.Method, "token")
+	assert.Equal(t, repositories[0].Destination.Auth.TokenName, "GITHUB_TOKEN")
+	assert.Equal(t, repositories[1].Source.Auth.Method, "token")
+	assert.Equal(t, repositories[1].Source.Auth.TokenName, "CUSTOM_TOKEN_1")
+	assert.Equal(t, repositories[1].Destination.Auth.Method, "token")
+	assert.Equal(t, repositories[1].Destination.Auth.TokenName, "CUSTOM_TOKEN_2")
+	assert.Equal(t, repositories[2].Source.Auth.TokenName, "GITLAB_TOKEN")
+	assert.Equal(t, repositories[2].Destination.Auth, Authentication{})
+}
+
+func Test_attemptLogger(t *testing.T) {
+	nextAttempt := attemptLogger(logrus.WithField("phase", "clone"))
+	assert.Equal(t, 1, nextAttempt().Data["attempt"])
+	entry := nextAttempt()
+	assert.Equal(t, 2, entry.Data["attempt"])
+	assert.Equal(t, "clone", entry.Data["phase"])
+}
+
+// testSignature returns the author of commits and the tagger of tags created in tests.
+func testSignature() *object.Signature {
+	return &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()}
+}
+
+// newTestRepository creates a repository with a single empty commit in a temporary directory, and returns
+// the repository, its directory and the hash of the commit.
+func newTestRepository(t *testing.T) (*git.Repository, string, gitplumbing.Hash) {
+	t.Helper()
+	directory := t.TempDir()
+	repository, err := git.PlainInit(directory, false)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return repository, directory, commitTestRepository(t, repository, git.CommitOptions{})
+}
+
+// commitTestRepository creates an empty commit on the current branch of repository.
+func commitTestRepository(t *testing.T, repository *git.Repository, options git.CommitOptions) gitplumbing.Hash {
+	t.Helper()
+	worktree, err := repository.Worktree()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	options.AllowEmptyCommits, options.Author = true, testSignature()
+	hash, err := worktree.Commit("Commit.", &options)
+	assert.NoError(t, err)
+	return hash
+}
+
+func Test_MirrorRepositoryLocal(t *testing.T) {
+	source, sourceDirectory, hash := newTestRepository(t)
+	feature := gitplumbing.NewHashReference(gitplumbing.NewBranchReferenceName("feature"), hash)
+	assert.NoError(t, source.Storer.SetReference(feature))
+	_, err := source.CreateTag("v1.0", hash, nil)
+	assert.NoError(t, err)
+
+	// The destination repository does not exist yet.
+	destinationDirectory := filepath.Join(t.TempDir(), "backup", "repo.git")
+	pair := RepositoryPair{
+		Source:      Repository{RepositoryURL: sourceDirectory},
+		Destination: Repository{RepositoryURL: "file://" + destinationDirectory},
+	}
+	s := New(WithWorkingDirectory(t.TempDir()))
+	mirror := func() MirrorStatus {
+		messages := make(chan MirrorStatus, 1)
+		s.MirrorRepository(context.Background(), messages, pair)
+		return <-messages
+	}
+	status := mirror()
+	assert.Empty(t, status.Errors)
+	expectedRefs := map[string]string{
+		"refs/heads/feature": hash.String(), "refs/heads/master": hash.String(), "refs/tags/v1.0": hash.String(),
+	}
+	assert.Equal(t, expectedRefs, status.Refs)
+	destination, err := git.PlainOpen(destinationDirectory)
+	assert.NoError(t, err)
+	_, err = destination.Reference(feature.Name(), false)
+	assert.NoError(t, err)
+
+	assert.NoError(t, source.Storer.RemoveReference(feature.Name()))
+	status = mirror()
+	assert.Empty(t, status.Errors)
+	_, err = destination.Reference(feature.Name(), false)
+	assert.ErrorIs(t, err, gitplumbing.ErrReferenceNotFound)
+}
+
+func Test_addPushedRef(t *testing.T) {
+	repository, _, hash := newTestRepository(t)
+	for _, branch := range []string{"main", "main-old", "main2"} {
+		ref := gitplumbing.NewHashReference(gitplumbing.NewBranchReferenceName(branch), hash)
+		assert.NoError(t, repository.Storer.SetReference(ref))
+	}
+	refs := make(map[string]string)
+	addPushedRef(repository, "refs/heads/main", refs)
+	addPushedRef(repository, "refs/heads/missing", refs)
+	assert.Equal(t, map[string]string{"refs/heads/main": hash.String()}, refs)
+}
+
+func Test_repositoryName(t *testing.T) {
+	for url, name := range map[string]string{
+		"https://example.com/org-1/repo-1":     "repo-1",
+		"https://example.com/org-1/repo-1.git": "repo-1",
+		"file:///srv/backup/repo-1.git/":       "repo-1",
+		"./repo-1":                             "repo-1",
+		`C:\backup\repo-1`:                     "repo-1",
+	} {
+		assert.Equal(t, name, repositoryName(url), url)
+	}
+	assert.True(t, IsLocalRepository("file:///srv/backup/repo-1.git"))
+	assert.True(t, IsLocalRepository("../repo-1"))
+	assert.False(t, IsLocalRepository("https://example.com/org-1/repo-1"))
+	assert.False(t, IsLocalRepository("example.com/org-1/repo-1"))
+}
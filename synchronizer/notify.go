@@ -0,0 +1,290 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Types of notifiers which can be set in the configuration file.
+const NotifierWebhook = "webhook"
+const NotifierSlack = "slack"
+const NotifierTeams = "teams"
+const NotifierCommand = "command"
+
+// Events for which notifications are sent.
+const EventRun = "run"
+const EventRepository = "repository"
+
+// States reported in notifications.
+const StateSuccess = "success"
+const StateFailure = "failure"
+const StateCancelled = "cancelled"
+
+const notificationTimeout = 30 * time.Second
+
+// NotifierConfig describes a notifier in the configuration file.
+type NotifierConfig struct {
+	// One of: webhook, slack, teams, command.
+	Type string `mapstructure:"type" yaml:"type"`
+	// URL to which notifications are posted by webhook, slack and teams notifiers.
+	URL string `mapstructure:"url" yaml:"url"`
+	// Shell command executed by command notifier.
+	Command string `mapstructure:"command" yaml:"command"`
+	// Events for which notifications are sent: run, repository. By default, both.
+	Events []string `mapstructure:"events" yaml:"events"`
+	// If true, notifications are only sent when the state changes from success to failure or vice versa.
+	OnlyOnStateChange bool `mapstructure:"only_on_state_change" yaml:"only_on_state_change"`
+}
+
+// Event is sent to notifiers when the synchronization run completes, or when synchronization
+// of a repository pair fails.
+type Event struct {
+	Type          string      `json:"type"`
+	State         string      `json:"state"`
+	PreviousState string      `json:"previous_state,omitempty"`
+	Source        string      `json:"source,omitempty"`
+	Destination   string      `json:"destination,omitempty"`
+	Errors        []SyncError `json:"errors,omitempty"`
+	Repositories  int         `json:"repositories,omitempty"`
+	Failed        int         `json:"failed,omitempty"`
+	Cancelled     int         `json:"cancelled,omitempty"`
+	Time          time.Time   `json:"time"`
+}
+
+// Message returns human-readable description of the event.
+func (e Event) Message() string {
+	var message string
+	if e.Type == EventRun {
+		message = fmt.Sprintf("git-synchronizer run finished with %s: %d repositories, %d failed, %d cancelled.",
+			e.State, e.Repositories, e.Failed, e.Cancelled)
+	} else {
+		message = fmt.Sprintf("git-synchronizer %s: %s → %s.", e.State, e.Source, e.Destination)
+	}
+	if e.PreviousState != "" && e.PreviousState != e.State {
+		message += " Previous state: " + e.PreviousState + "."
+	}
+	for _, err := range e.Errors {
+		message += "\n" + err.Message
+	}
+	return message
+}
+
+// Notifier delivers events.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// WebhookNotifier posts events as JSON to URL.
+type WebhookNotifier struct {
+	URL string
+}
+
+func (n WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	return postJSON(ctx, n.URL, event)
+}
+
+// ChatNotifier posts events to a Slack or Microsoft Teams incoming webhook URL.
+type ChatNotifier struct {
+	URL string
+}
+
+func (n ChatNotifier) Notify(ctx context.Context, event Event) error {
+	return postJSON(ctx, n.URL, map[string]string{"text": event.Message()})
+}
+
+// CommandNotifier runs a shell command for each event. The event is passed as JSON on standard
+// input, and its most important fields as GITSYNCHRONIZER_EVENT_* environment variables.
+type CommandNotifier struct {
+	Command string
+}
+
+func (n CommandNotifier) Notify(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var command *exec.Cmd
+	if runtime.GOOS == "windows" {
+		command = exec.CommandContext(ctx, "cmd", "/C", n.Command)
+	} else {
+		command = exec.CommandContext(ctx, "sh", "-c", n.Command)
+	}
+	command.Stdin = bytes.NewReader(payload)
+	command.Env = append(os.Environ(),
+		"GITSYNCHRONIZER_EVENT_TYPE="+event.Type,
+		"GITSYNCHRONIZER_EVENT_STATE="+event.State,
+		"GITSYNCHRONIZER_EVENT_PREVIOUS_STATE="+event.PreviousState,
+		"GITSYNCHRONIZER_EVENT_SOURCE="+event.Source,
+		"GITSYNCHRONIZER_EVENT_DESTINATION="+event.Destination,
+	)
+	output, err := command.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func postJSON(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return errors.New("unexpected response status: " + response.Status)
+	}
+	return nil
+}
+
+// NotificationRule describes which events are delivered to a notifier.
+type NotificationRule struct {
+	Notifier Notifier
+	// Events for which notifications are sent. If empty, all events are sent.
+	Events            []string
+	OnlyOnStateChange bool
+}
+
+// NewNotificationRule returns notification rule described by config.
+func NewNotificationRule(config NotifierConfig) (NotificationRule, error) {
+	rule := NotificationRule{Events: config.Events, OnlyOnStateChange: config.OnlyOnStateChange}
+	for _, event := range config.Events {
+		if event != EventRun && event != EventRepository {
+			return rule, errors.New("unknown notification event: " + event)
+		}
+	}
+	switch config.Type {
+	case NotifierWebhook:
+		rule.Notifier = WebhookNotifier{config.URL}
+	case NotifierSlack, NotifierTeams:
+		rule.Notifier = ChatNotifier{config.URL}
+	case NotifierCommand:
+		if config.Command == "" {
+			return rule, errors.New("command notifier requires command")
+		}
+		return NotificationRule{CommandNotifier{config.Command}, config.Events, config.OnlyOnStateChange}, nil
+	default:
+		return rule, errors.New("unknown notifier type: " + config.Type)
+	}
+	if config.URL == "" {
+		return rule, errors.New(config.Type + " notifier requires url")
+	}
+	return rule, nil
+}
+
+// matches returns true if event should be delivered according to the rule.
+func (r NotificationRule) matches(event Event) bool {
+	if len(r.Events) > 0 && !stringInSlice(event.Type, r.Events) {
+		return false
+	}
+	if r.OnlyOnStateChange {
+		return event.State != StateCancelled && event.PreviousState != event.State
+	}
+	return event.Type == EventRun || event.State == StateFailure
+}
+
+// getState returns the state of repository pair synchronization.
+func (status MirrorStatus) getState() string {
+	switch {
+	case status.Cancelled:
+		return StateCancelled
+	case len(status.Errors) > 0:
+		return StateFailure
+	default:
+		return StateSuccess
+	}
+}
+
+// notify sends events describing result to all notifiers according to their rules. previous is
+// the state recorded before the operation of the given kind started and is used to detect state changes.
+func (s *Syncer) notify(ctx context.Context, result Result, previous State, kind string) {
+	if len(s.notificationRules) == 0 {
+		return
+	}
+	now := time.Now()
+	var events []Event
+	for _, status := range result.Repositories {
+		state := status.getState()
+		if state == StateCancelled {
+			continue
+		}
+		previousState := StateSuccess
+		repository := previous.Repository(status.Source, status.Destination)
+		if repository != nil && repository.failed(kind) {
+			previousState = StateFailure
+		}
+		events = append(events, Event{
+			Type: EventRepository, State: state, PreviousState: previousState, Source: status.Source,
+			Destination: status.Destination, Errors: status.Errors, Time: now,
+		})
+	}
+
+	runEvent := Event{
+		Type: EventRun, State: result.State(), Repositories: len(result.Repositories),
+		Cancelled: len(result.Cancelled()), Time: now,
+	}
+	// Only the state of the last synchronization run is recorded.
+	if kind == operationMirror {
+		runEvent.PreviousState = previous.LastRun
+	}
+	if runEvent.PreviousState == "" {
+		runEvent.PreviousState = StateSuccess
+	}
+	for _, status := range result.Repositories {
+		if status.getState() == StateFailure {
+			runEvent.Failed++
+		}
+	}
+	events = append(events, runEvent)
+
+	for _, event := range events {
+		for _, rule := range s.notificationRules {
+			if !rule.matches(event) {
+				continue
+			}
+			if err := sendNotification(ctx, rule.Notifier, event); err != nil {
+				s.logger.WithError(err).WithField("event", event.Type).Error("Sending notification failed.")
+			}
+		}
+	}
+}
+
+// sendNotification sends event with notifier, giving it notificationTimeout regardless of the time taken
+// by other notifications. Notifications are sent even if synchronization has been cancelled.
+func sendNotification(ctx context.Context, notifier Notifier, event Event) error {
+	notificationCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notificationTimeout)
+	defer cancel()
+	return notifier.Notify(notificationCtx, event)
+}
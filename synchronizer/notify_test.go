@@ -0,0 +1,119 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingNotifier struct {
+	events []Event
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, event Event) error {
+	n.events = append(n.events, event)
+	return nil
+}
+
+// slowNotifier records deadlines of the notifications it sends, each of which takes some time.
+type slowNotifier struct {
+	deadlines []time.Time
+}
+
+func (n *slowNotifier) Notify(ctx context.Context, _ Event) error {
+	deadline, _ := ctx.Deadline()
+	n.deadlines = append(n.deadlines, deadline)
+	time.Sleep(10 * time.Millisecond)
+	return nil
+}
+
+func Test_NewNotificationRule(t *testing.T) {
+	_, err := NewNotificationRule(NotifierConfig{Type: "email"})
+	assert.EqualError(t, err, "unknown notifier type: email")
+	_, err = NewNotificationRule(NotifierConfig{Type: "slack"})
+	assert.EqualError(t, err, "slack notifier requires url")
+	_, err = NewNotificationRule(NotifierConfig{Type: "command", Events: []string{"push"}, Command: "true"})
+	assert.EqualError(t, err, "unknown notification event: push")
+	rule, err := NewNotificationRule(NotifierConfig{Type: "teams", URL: "https://example.com/hook"})
+	assert.NoError(t, err)
+	assert.Equal(t, ChatNotifier{"https://example.com/hook"}, rule.Notifier)
+}
+
+func Test_notifyOnStateChange(t *testing.T) {
+	all, changes := &recordingNotifier{}, &recordingNotifier{}
+	s := New(WithWorkingDirectory(t.TempDir()), WithNotifications(
+		NotificationRule{Notifier: all},
+		NotificationRule{Notifier: changes, Events: []string{EventRepository}, OnlyOnStateChange: true},
+	))
+	failed := Result{Repositories: []MirrorStatus{
+		{Source: "a", Destination: "b", Errors: []SyncError{{Kind: ErrorRejectedPush, Message: "push failed"}}},
+		{Source: "c", Destination: "d"},
+	}}
+	succeeded := Result{Repositories: []MirrorStatus{{Source: "a", Destination: "b"}, {Source: "c", Destination: "d"}}}
+
+	var state State
+	for _, result := range []Result{failed, failed, succeeded} {
+		s.notify(context.Background(), result, state, operationMirror)
+		for _, status := range result.Repositories {
+			state.update(status, operationMirror, time.Now())
+		}
+		state.LastRun = result.State()
+	}
+
+	var allStates []string
+	for _, e := range all.events {
+		allStates = append(allStates, e.Type+":"+e.State)
+	}
+	assert.Equal(t, []string{
+		"repository:failure", "run:failure", "repository:failure", "run:failure", "run:success",
+	}, allStates)
+	assert.Len(t, changes.events, 2)
+	assert.Equal(t, StateFailure, changes.events[0].State)
+	assert.Equal(t, StateSuccess, changes.events[1].State)
+	assert.Equal(t, StateFailure, changes.events[1].PreviousState)
+}
+
+func Test_notifyTimeout(t *testing.T) {
+	notifier := &slowNotifier{}
+	s := New(WithWorkingDirectory(t.TempDir()), WithNotifications(NotificationRule{Notifier: notifier}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	failed := MirrorStatus{Source: "a", Destination: "b", Errors: []SyncError{{Kind: ErrorNetwork, Message: "timeout"}}}
+	s.notify(ctx, Result{Repositories: []MirrorStatus{failed}}, State{}, operationMirror)
+	// Each notification is given the whole timeout, even after synchronization has been cancelled.
+	if assert.Len(t, notifier.deadlines, 2) {
+		assert.True(t, notifier.deadlines[1].After(notifier.deadlines[0]))
+	}
+}
+
+func Test_WebhookNotifier(t *testing.T) {
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	err := WebhookNotifier{server.URL}.Notify(context.Background(), Event{Type: EventRun, State: StateSuccess})
+	assert.NoError(t, err)
+	assert.Equal(t, StateSuccess, received.State)
+}
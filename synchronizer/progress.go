@@ -0,0 +1,76 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Phases of repository pair synchronization reported to ProgressReporter.
+const PhaseListing = "listing"
+const PhaseCloning = "cloning"
+const PhaseFetching = "fetching"
+const PhasePushingBranches = "pushing branches"
+const PhaseDeletingBranches = "deleting branches"
+const PhasePushingTags = "pushing tags"
+const PhaseDeletingTags = "deleting tags"
+
+// ProgressReporter receives updates about repository pairs being synchronized by Mirror.
+// Its methods are called concurrently from multiple goroutines.
+type ProgressReporter interface {
+	// Phase is called when synchronization of the repository pair enters phase. For phases processing
+	// multiple refs, done out of total refs have been processed, otherwise total is 0.
+	Phase(source, destination, phase string, done, total int)
+	// Transfer is called with progress messages sent by the git server, e.g. "Counting objects: 50% (5/10)".
+	Transfer(source, destination, message string)
+	// Finished is called when synchronization of the repository pair completes.
+	Finished(status MirrorStatus)
+}
+
+type noProgress struct{}
+
+func (noProgress) Phase(_, _, _ string, _, _ int) {}
+func (noProgress) Transfer(_, _, _ string)        {}
+func (noProgress) Finished(_ MirrorStatus)        {}
+
+// transferWriter passes the last line written by go-git to ProgressReporter.
+type transferWriter struct {
+	progress    ProgressReporter
+	source      string
+	destination string
+}
+
+func (w transferWriter) Write(p []byte) (int, error) {
+	lines := strings.FieldsFunc(string(p), func(r rune) bool { return r == '\r' || r == '\n' })
+	if len(lines) > 0 {
+		w.progress.Transfer(w.source, w.destination, strings.TrimSpace(lines[len(lines)-1]))
+	}
+	return len(p), nil
+}
+
+// transferProgress returns writer for go-git Progress options of the repository pair identified
+// by the source and destination fields of logger.
+func (s *Syncer) transferProgress(logger *logrus.Entry) io.Writer {
+	if _, ok := s.progress.(noProgress); ok {
+		// Without Progress writer, the server is asked not to send progress messages.
+		return nil
+	}
+	return transferWriter{s.progress, fmt.Sprint(logger.Data["source"]), fmt.Sprint(logger.Data["destination"])}
+}
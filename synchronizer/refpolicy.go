@@ -0,0 +1,78 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// ModeMirror removes branches and tags which are not present in the source repository from the destination.
+const ModeMirror = "mirror"
+
+// ModeAdditive never removes branches or tags from the destination repository.
+const ModeAdditive = "additive"
+
+// SetRepositoryRefPolicy ensures that repositories for which the mode, preserved patterns and tag policy
+// have not been set, use the default ones from config file. Tags only mode and unprotecting branches set
+// in defaults apply to all repositories.
+func SetRepositoryRefPolicy(repositories *[]RepositoryPair, defaultSettings RepositoryPair) {
+	for i := 0; i < len(*repositories); i++ {
+		if (*repositories)[i].Mode == "" {
+			(*repositories)[i].Mode = defaultSettings.Mode
+		}
+		if (*repositories)[i].Preserve == nil {
+			(*repositories)[i].Preserve = defaultSettings.Preserve
+		}
+		if (*repositories)[i].TagPolicy == "" {
+			(*repositories)[i].TagPolicy = defaultSettings.TagPolicy
+		}
+		(*repositories)[i].TagsOnly = (*repositories)[i].TagsOnly || defaultSettings.TagsOnly
+		(*repositories)[i].UnprotectBranches = (*repositories)[i].UnprotectBranches || defaultSettings.UnprotectBranches
+	}
+}
+
+// preserves returns true if ref (branch or tag name) matches any of the preserved patterns. As in repository
+// filters, * in patterns also matches /, so internal/* preserves internal/team/ci.
+func (p RepositoryPair) preserves(ref string) bool {
+	for _, pattern := range p.Preserve {
+		if matchPattern(pattern, ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// refsToDelete returns refs from destinationRefs which are not present in sourceRefs and should be removed
+// from the destination repository. Full names (with prefix) of refs which are kept despite not being present
+// in the source repository are appended to preserved.
+func (p RepositoryPair) refsToDelete(destinationRefs, sourceRefs []string, prefix string, preserved *[]string,
+	logger *logrus.Entry) []string {
+	var refs []string
+	for _, ref := range destinationRefs {
+		if stringInSlice(ref, sourceRefs) {
+			continue
+		}
+		// Tags never change in the destination repository if they are immutable.
+		immutable := prefix == refTagPrefix && p.TagPolicy == TagPolicyImmutable
+		if p.Mode == ModeAdditive || immutable || p.preserves(ref) {
+			logger.WithField("ref", prefix+ref).Debug("Preserving ref not present in the source repository.")
+			*preserved = append(*preserved, prefix+ref)
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_refsToDelete(t *testing.T) {
+	logger := logrus.WithField("phase", "delete")
+	destination := []string{"internal/ci", "internal/team/ci", "main", "old-feature", "release/1.0"}
+	source := []string{"main"}
+
+	var preserved []string
+	pair := RepositoryPair{Preserve: []string{"internal/*", "release/*"}}
+	assert.Equal(t, []string{"old-feature"}, pair.refsToDelete(destination, source, refBranchPrefix, &preserved, logger))
+	assert.Equal(t, []string{"refs/heads/internal/ci", "refs/heads/internal/team/ci", "refs/heads/release/1.0"},
+		preserved)
+
+	preserved = nil
+	pair = RepositoryPair{Mode: ModeAdditive}
+	assert.Empty(t, pair.refsToDelete(destination, source, refTagPrefix, &preserved, logger))
+	assert.Len(t, preserved, 4)
+
+	preserved = nil
+	pair = RepositoryPair{TagPolicy: TagPolicyImmutable}
+	assert.Empty(t, pair.refsToDelete(destination, source, refTagPrefix, &preserved, logger))
+	assert.Len(t, pair.refsToDelete(destination, source, refBranchPrefix, &preserved, logger), 4)
+}
+
+func Test_SetRepositoryRefPolicy(t *testing.T) {
+	repositories := []RepositoryPair{{}, {Mode: ModeMirror, Preserve: []string{}}}
+	SetRepositoryRefPolicy(&repositories, RepositoryPair{
+		Mode: ModeAdditive, Preserve: []string{"internal/*"}, TagPolicy: TagPolicyImmutable, TagsOnly: true,
+		UnprotectBranches: true,
+	})
+	assert.Equal(t, ModeAdditive, repositories[0].Mode)
+	assert.Equal(t, TagPolicyImmutable, repositories[0].TagPolicy)
+	assert.True(t, repositories[1].TagsOnly)
+	assert.True(t, repositories[0].UnprotectBranches)
+	assert.True(t, repositories[1].UnprotectBranches)
+	assert.Equal(t, []string{"internal/*"}, repositories[0].Preserve)
+	assert.Equal(t, ModeMirror, repositories[1].Mode)
+	assert.Empty(t, repositories[1].Preserve)
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"context"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+)
+
+// Maximum time spent retrying an operation, unless overridden in the configuration file.
+const defaultLongMaxElapsedTime = 2 * time.Minute
+const defaultShortMaxElapsedTime = time.Minute
+
+// Timeouts of a single attempt of a network operation, unless overridden in the configuration file.
+const defaultListTimeout = 10 * time.Second
+const defaultTransferTimeout = 30 * time.Minute
+
+// RetryPolicy describes how network operations are retried. Zero values mean that the default
+// settings for the given operation are used.
+type RetryPolicy struct {
+	MaxElapsedTime  time.Duration `mapstructure:"max_elapsed_time" yaml:"max_elapsed_time"`
+	InitialInterval time.Duration `mapstructure:"initial_interval" yaml:"initial_interval"`
+	MaxInterval     time.Duration `mapstructure:"max_interval" yaml:"max_interval"`
+	MaxAttempts     uint64        `mapstructure:"max_attempts" yaml:"max_attempts"`
+	// Timeouts of a single attempt of listing refs, and of cloning, fetching or pushing.
+	ListTimeout     time.Duration `mapstructure:"list_timeout" yaml:"list_timeout"`
+	TransferTimeout time.Duration `mapstructure:"transfer_timeout" yaml:"transfer_timeout"`
+}
+
+// SetRepositoryRetryPolicy ensures that repositories use the default retry settings from config file
+// for any retry settings which have not been overridden.
+func SetRepositoryRetryPolicy(repositories *[]RepositoryPair, defaultSettings RepositoryPair) {
+	for i := 0; i < len(*repositories); i++ {
+		(*repositories)[i].Retry = (*repositories)[i].Retry.withDefaults(defaultSettings.Retry)
+	}
+}
+
+// withDefaults returns the policy with zero values replaced by values from defaultPolicy.
+func (p RetryPolicy) withDefaults(defaultPolicy RetryPolicy) RetryPolicy {
+	if p.MaxElapsedTime == 0 {
+		p.MaxElapsedTime = defaultPolicy.MaxElapsedTime
+	}
+	if p.InitialInterval == 0 {
+		p.InitialInterval = defaultPolicy.InitialInterval
+	}
+	if p.MaxInterval == 0 {
+		p.MaxInterval = defaultPolicy.MaxInterval
+	}
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = defaultPolicy.MaxAttempts
+	}
+	if p.ListTimeout == 0 {
+		p.ListTimeout = defaultPolicy.ListTimeout
+	}
+	if p.TransferTimeout == 0 {
+		p.TransferTimeout = defaultPolicy.TransferTimeout
+	}
+	return p
+}
+
+// NewBackOff returns exponential backoff configured according to the policy, which stops retrying
+// once ctx is cancelled. defaultMaxElapsedTime is used if the maximum elapsed time has not been set.
+func (p RetryPolicy) NewBackOff(ctx context.Context, defaultMaxElapsedTime time.Duration) backoff.BackOff {
+	exponentialBackoff := backoff.NewExponentialBackOff()
+	exponentialBackoff.MaxElapsedTime = defaultMaxElapsedTime
+	if p.MaxElapsedTime > 0 {
+		exponentialBackoff.MaxElapsedTime = p.MaxElapsedTime
+	}
+	if p.InitialInterval > 0 {
+		exponentialBackoff.InitialInterval = p.InitialInterval
+	}
+	if p.MaxInterval > 0 {
+		exponentialBackoff.MaxInterval = p.MaxInterval
+	}
+	exponentialBackoff.Reset()
+	if p.MaxAttempts > 0 {
+		// The first attempt is not a retry.
+		return backoff.WithContext(backoff.WithMaxRetries(exponentialBackoff, p.MaxAttempts-1), ctx)
+	}
+	return backoff.WithContext(exponentialBackoff, ctx)
+}
+
+// GetListTimeout returns timeout of a single attempt of listing refs.
+func (p RetryPolicy) GetListTimeout() time.Duration {
+	if p.ListTimeout > 0 {
+		return p.ListTimeout
+	}
+	return defaultListTimeout
+}
+
+// GetTransferTimeout returns timeout of a single attempt of cloning, fetching or pushing.
+func (p RetryPolicy) GetTransferTimeout() time.Duration {
+	if p.TransferTimeout > 0 {
+		return p.TransferTimeout
+	}
+	return defaultTransferTimeout
+}
+
+// operationContext returns context for a single attempt of a network operation. The context expires
+// after timeout, or after the grace period has elapsed since ctx has been cancelled. This way, operations
+// in progress can complete during graceful shutdown.
+func (s *Syncer) operationContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	operationCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	stop := context.AfterFunc(ctx, func() { time.AfterFunc(s.gracePeriod, cancel) })
+	return operationCtx, func() {
+		stop()
+		cancel()
+	}
+}
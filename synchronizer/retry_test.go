@@ -0,0 +1,74 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SetRepositoryRetryPolicy(t *testing.T) {
+	repositories := []RepositoryPair{
+		{},
+		{Retry: RetryPolicy{MaxAttempts: 3, ListTimeout: time.Minute}},
+	}
+	defaultSettings := RepositoryPair{
+		Retry: RetryPolicy{MaxElapsedTime: 5 * time.Minute, MaxAttempts: 10, TransferTimeout: time.Hour},
+	}
+	SetRepositoryRetryPolicy(&repositories, defaultSettings)
+	assert.Equal(t, RetryPolicy{MaxElapsedTime: 5 * time.Minute, MaxAttempts: 10, TransferTimeout: time.Hour},
+		repositories[0].Retry)
+	assert.Equal(t, RetryPolicy{
+		MaxElapsedTime: 5 * time.Minute, MaxAttempts: 3, ListTimeout: time.Minute, TransferTimeout: time.Hour,
+	}, repositories[1].Retry)
+	// Limiting listing refs does not affect cloning and pushing.
+	assert.Equal(t, time.Minute, repositories[1].Retry.GetListTimeout())
+	assert.Equal(t, time.Hour, repositories[1].Retry.GetTransferTimeout())
+	assert.Equal(t, defaultListTimeout, repositories[0].Retry.GetListTimeout())
+	assert.Equal(t, defaultTransferTimeout, RetryPolicy{}.GetTransferTimeout())
+}
+
+func Test_RetryPolicyMaxAttempts(t *testing.T) {
+	policy := RetryPolicy{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, MaxAttempts: 3}
+	attempts := 0
+	err := backoff.Retry(func() error {
+		attempts++
+		return errors.New("network error")
+	}, policy.NewBackOff(context.Background(), defaultShortMaxElapsedTime))
+	assert.Error(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func Test_operationContext(t *testing.T) {
+	s := New(WithGracePeriod(50 * time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	operationCtx, operationCancel := s.operationContext(ctx, time.Minute)
+	defer operationCancel()
+	cancel()
+	// Operation in progress is given the grace period to complete.
+	assert.NoError(t, operationCtx.Err())
+	select {
+	case <-operationCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("operation context has not been cancelled after the grace period")
+	}
+}
@@ -0,0 +1,315 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	gitplumbing "github.com/go-git/go-git/v5/plumbing"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrUnverifiedSignature is reported for refs which are not pushed because their signature is missing or invalid.
+var ErrUnverifiedSignature = errors.New("signature verification failed")
+
+const pgpSignatureHeader = "-----BEGIN PGP SIGNATURE-----"
+const sshSignatureHeader = "-----BEGIN SSH SIGNATURE-----"
+
+// Signatures created by git with SSH keys use this namespace.
+const sshSignatureNamespace = "git"
+
+// SignaturePolicy describes which refs have to be signed by trusted keys before they are pushed
+// to the destination repository.
+type SignaturePolicy struct {
+	// File with armored OpenPGP public keys.
+	Keyring string `mapstructure:"keyring" yaml:"keyring"`
+	// File with SSH public keys, one per line, in authorized_keys or git allowed signers format.
+	SSHKeys string `mapstructure:"ssh_keys" yaml:"ssh_keys"`
+	// Patterns of branch names whose tip commits have to be signed, e.g. release/*.
+	Branches []string `mapstructure:"branches" yaml:"branches"`
+	// If true, annotated tags have to be signed, and lightweight tags have to point to signed commits.
+	Tags bool `mapstructure:"tags" yaml:"tags"`
+}
+
+// Enabled returns true if signatures of any refs have to be verified.
+func (p SignaturePolicy) Enabled() bool {
+	return len(p.Branches) > 0 || p.Tags
+}
+
+// withDefaults returns the policy with unset values replaced by values from defaultPolicy.
+func (p SignaturePolicy) withDefaults(defaultPolicy SignaturePolicy) SignaturePolicy {
+	if p.Keyring == "" {
+		p.Keyring = defaultPolicy.Keyring
+	}
+	if p.SSHKeys == "" {
+		p.SSHKeys = defaultPolicy.SSHKeys
+	}
+	if p.Branches == nil {
+		p.Branches = defaultPolicy.Branches
+	}
+	p.Tags = p.Tags || defaultPolicy.Tags
+	return p
+}
+
+// SetRepositorySignaturePolicy ensures that repositories for which the signature verification settings
+// have not been overridden, use the default ones from config file.
+func SetRepositorySignaturePolicy(repositories *[]RepositoryPair, defaultSettings RepositoryPair) {
+	for i := 0; i < len(*repositories); i++ {
+		(*repositories)[i].VerifySignatures = (*repositories)[i].VerifySignatures.withDefaults(
+			defaultSettings.VerifySignatures,
+		)
+	}
+}
+
+// coversBranch returns true if the tip of branch has to be signed.
+func (p SignaturePolicy) coversBranch(branch string) bool {
+	for _, pattern := range p.Branches {
+		if matchPattern(pattern, branch) {
+			return true
+		}
+	}
+	return false
+}
+
+// signatureVerifier verifies signatures of commits and tags against trusted keys.
+type signatureVerifier struct {
+	// Armored OpenPGP keyring.
+	keyring string
+	sshKeys []ssh.PublicKey
+}
+
+// newSignatureVerifier reads trusted keys configured in policy.
+func newSignatureVerifier(policy SignaturePolicy) (*signatureVerifier, error) {
+	if policy.Keyring == "" && policy.SSHKeys == "" {
+		return nil, errors.New("neither keyring nor SSH keys have been configured for signature verification")
+	}
+	verifier := &signatureVerifier{}
+	if policy.Keyring != "" {
+		keyring, err := os.ReadFile(policy.Keyring)
+		if err != nil {
+			return nil, err
+		}
+		verifier.keyring = string(keyring)
+	}
+	if policy.SSHKeys != "" {
+		keys, err := os.ReadFile(policy.SSHKeys)
+		if err != nil {
+			return nil, err
+		}
+		verifier.sshKeys, err = parseSSHKeys(keys)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", policy.SSHKeys, err)
+		}
+	}
+	return verifier, nil
+}
+
+// parseSSHKeys returns public keys listed in data, skipping empty lines and comments.
+// Principals in git allowed signers files are ignored.
+func parseSSHKeys(data []byte) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	for {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			if len(keys) == 0 {
+				return nil, err
+			}
+			return keys, nil
+		}
+		keys = append(keys, key)
+		data = rest
+	}
+}
+
+// verify checks signature of message, as created by git for commits and tags.
+func (v *signatureVerifier) verify(signature string, message []byte, verifyPGP func(string) error) error {
+	switch {
+	case signature == "":
+		return fmt.Errorf("%w: not signed", ErrUnverifiedSignature)
+	case strings.HasPrefix(signature, sshSignatureHeader):
+		if err := v.verifySSH(signature, message); err != nil {
+			return fmt.Errorf("%w: %w", ErrUnverifiedSignature, err)
+		}
+	case strings.HasPrefix(signature, pgpSignatureHeader):
+		if v.keyring == "" {
+			return fmt.Errorf("%w: no OpenPGP keyring configured", ErrUnverifiedSignature)
+		}
+		if err := verifyPGP(v.keyring); err != nil {
+			return fmt.Errorf("%w: %w", ErrUnverifiedSignature, err)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported signature format", ErrUnverifiedSignature)
+	}
+	return nil
+}
+
+// verifySSH checks SSH signature of message according to the SSHSIG format used by git.
+func (v *signatureVerifier) verifySSH(armoredSignature string, message []byte) error {
+	block, _ := pem.Decode([]byte(armoredSignature))
+	if block == nil || block.Type != "SSH SIGNATURE" {
+		return errors.New("malformed SSH signature")
+	}
+	var signature struct {
+		Magic         [6]byte
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := ssh.Unmarshal(block.Bytes, &signature); err != nil {
+		return err
+	}
+	if string(signature.Magic[:]) != "SSHSIG" || signature.Version != 1 {
+		return errors.New("unsupported SSH signature version")
+	}
+	if signature.Namespace != sshSignatureNamespace {
+		return errors.New("SSH signature namespace is " + signature.Namespace)
+	}
+	publicKey, err := ssh.ParsePublicKey(signature.PublicKey)
+	if err != nil {
+		return err
+	}
+	trusted := false
+	for _, key := range v.sshKeys {
+		trusted = trusted || bytes.Equal(key.Marshal(), publicKey.Marshal())
+	}
+	if !trusted {
+		return errors.New("signed with untrusted key " + ssh.FingerprintSHA256(publicKey))
+	}
+	var messageHash hash.Hash
+	switch signature.HashAlgorithm {
+	case "sha256":
+		messageHash = sha256.New()
+	case "sha512":
+		messageHash = sha512.New()
+	default:
+		return errors.New("unsupported SSH signature hash algorithm " + signature.HashAlgorithm)
+	}
+	messageHash.Write(message)
+	var sshSignature ssh.Signature
+	if err = ssh.Unmarshal(signature.Signature, &sshSignature); err != nil {
+		return err
+	}
+	return publicKey.Verify(sshSignedData(signature.Namespace, signature.HashAlgorithm, messageHash.Sum(nil)),
+		&sshSignature)
+}
+
+// sshSignedData returns data signed by SSH key for message with messageHash.
+func sshSignedData(namespace, hashAlgorithm string, messageHash []byte) []byte {
+	return append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{namespace, "", hashAlgorithm, messageHash})...)
+}
+
+// signedMessage returns the signed part of a commit or tag, as written by encode.
+func signedMessage(encode func(gitplumbing.EncodedObject) error) ([]byte, error) {
+	encoded := &gitplumbing.MemoryObject{}
+	if err := encode(encoded); err != nil {
+		return nil, err
+	}
+	reader, err := encoded.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// verifyCommit checks the signature of commit with hash in repository.
+func (v *signatureVerifier) verifyCommit(repository *git.Repository, hash gitplumbing.Hash) error {
+	commit, err := repository.CommitObject(hash)
+	if err != nil {
+		return err
+	}
+	message, err := signedMessage(commit.EncodeWithoutSignature)
+	if err != nil {
+		return err
+	}
+	return v.verify(commit.PGPSignature, message, func(keyring string) error {
+		_, err := commit.Verify(keyring)
+		return err
+	})
+}
+
+// verifyTag checks the signature of annotated tag ref, or of the commit lightweight tag ref points to.
+func (v *signatureVerifier) verifyTag(repository *git.Repository, ref *gitplumbing.Reference) error {
+	tag, err := repository.TagObject(ref.Hash())
+	if errors.Is(err, gitplumbing.ErrObjectNotFound) {
+		return v.verifyCommit(repository, ref.Hash())
+	} else if err != nil {
+		return err
+	}
+	message, err := signedMessage(tag.EncodeWithoutSignature)
+	if err != nil {
+		return err
+	}
+	return v.verify(tag.PGPSignature, message, func(keyring string) error {
+		_, err := tag.Verify(keyring)
+		return err
+	})
+}
+
+// verifyBranch checks the signature of the tip of branch in repository, if policy requires it.
+// Nothing is verified if v is nil.
+func (v *signatureVerifier) verifyBranch(repository *git.Repository, policy SignaturePolicy, branch string) error {
+	if v == nil || !policy.coversBranch(branch) {
+		return nil
+	}
+	ref, err := repository.Reference(gitplumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		return err
+	}
+	return v.verifyCommit(repository, ref.Hash())
+}
+
+// withholdUnverifiedTags removes tags whose signature cannot be verified from the local repository,
+// so that they are not pushed. They are marked as unverified in tags and reported as errors.
+func (v *signatureVerifier) withholdUnverifiedTags(repository *git.Repository, tags []TagStatus, destination string,
+	logger *logrus.Entry, allErrors *[]SyncError) error {
+	for i, tag := range tags {
+		ref, err := repository.Reference(gitplumbing.NewTagReferenceName(tag.Name), false)
+		if err != nil {
+			return err
+		}
+		verifyErr := v.verifyTag(repository, ref)
+		if verifyErr == nil {
+			continue
+		}
+		tags[i].Unverified = true
+		ProcessError(logger.WithField("ref", ref.Name().String()), verifyErr,
+			"verifying signature of tag "+tag.Name+" to be pushed to ", destination, allErrors)
+		if err = repository.Storer.RemoveReference(ref.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
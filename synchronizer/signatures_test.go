@@ -0,0 +1,145 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	git "github.com/go-git/go-git/v5"
+	gitplumbing "github.com/go-git/go-git/v5/plumbing"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshSigner signs git objects the way git does with SSH keys.
+type sshSigner struct {
+	signer ssh.Signer
+}
+
+func (s sshSigner) Sign(message io.Reader) ([]byte, error) {
+	messageHash := sha512.New()
+	if _, err := io.Copy(messageHash, message); err != nil {
+		return nil, err
+	}
+	signature, err := s.signer.Sign(rand.Reader, sshSignedData(sshSignatureNamespace, "sha512", messageHash.Sum(nil)))
+	if err != nil {
+		return nil, err
+	}
+	blob := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}{1, s.signer.PublicKey().Marshal(), sshSignatureNamespace, "", "sha512", ssh.Marshal(signature)})...)
+	return pem.EncodeToMemory(&pem.Block{Type: "SSH SIGNATURE", Bytes: blob}), nil
+}
+
+func newSSHSigner(t *testing.T) sshSigner {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	assert.NoError(t, err)
+	return sshSigner{signer}
+}
+
+func armoredPublicKey(t *testing.T, entity *openpgp.Entity) []byte {
+	var b bytes.Buffer
+	w, err := armor.Encode(&b, openpgp.PublicKeyType, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, entity.Serialize(w))
+	assert.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+func Test_signatureVerifier(t *testing.T) {
+	repository, _, _ := newTestRepository(t)
+	commit := func(options git.CommitOptions) gitplumbing.Hash {
+		return commitTestRepository(t, repository, options)
+	}
+	trustedEntity, err := openpgp.NewEntity("Trusted", "", "trusted@example.com", nil)
+	assert.NoError(t, err)
+	otherEntity, err := openpgp.NewEntity("Other", "", "other@example.com", nil)
+	assert.NoError(t, err)
+	trustedSSH, otherSSH := newSSHSigner(t), newSSHSigner(t)
+
+	keysDirectory := t.TempDir()
+	keyring := filepath.Join(keysDirectory, "keyring.asc")
+	assert.NoError(t, os.WriteFile(keyring, armoredPublicKey(t, trustedEntity), 0600))
+	sshKeys := filepath.Join(keysDirectory, "allowed_signers")
+	assert.NoError(t, os.WriteFile(sshKeys, append([]byte("# Release managers\ntrusted@example.com "),
+		ssh.MarshalAuthorizedKey(trustedSSH.signer.PublicKey())...), 0600))
+	verifier, err := newSignatureVerifier(SignaturePolicy{Keyring: keyring, SSHKeys: sshKeys})
+	assert.NoError(t, err)
+
+	assert.NoError(t, verifier.verifyCommit(repository, commit(git.CommitOptions{SignKey: trustedEntity})))
+	assert.NoError(t, verifier.verifyCommit(repository, commit(git.CommitOptions{Signer: trustedSSH})))
+	for _, hash := range []gitplumbing.Hash{
+		commit(git.CommitOptions{}),
+		commit(git.CommitOptions{SignKey: otherEntity}),
+		commit(git.CommitOptions{Signer: otherSSH}),
+	} {
+		assert.ErrorIs(t, verifier.verifyCommit(repository, hash), ErrUnverifiedSignature)
+	}
+
+	head := commit(git.CommitOptions{Signer: trustedSSH})
+	_, err = repository.CreateTag("lightweight", head, nil)
+	assert.NoError(t, err)
+	_, err = repository.CreateTag("signed", head, &git.CreateTagOptions{
+		Tagger: testSignature(), Message: "Signed.", SignKey: trustedEntity,
+	})
+	assert.NoError(t, err)
+	_, err = repository.CreateTag("unsigned", head, &git.CreateTagOptions{Tagger: testSignature(), Message: "Unsigned."})
+	assert.NoError(t, err)
+	tags, _, err := localTags(repository)
+	assert.NoError(t, err)
+	var allErrors []SyncError
+	assert.NoError(t, verifier.withholdUnverifiedTags(repository, tags, "destination", logrus.WithField("phase", "push"),
+		&allErrors))
+	assert.Equal(t, []TagStatus{
+		{Name: "lightweight"}, {Name: "signed", Annotated: true}, {Name: "unsigned", Annotated: true, Unverified: true},
+	}, tags)
+	assert.Len(t, allErrors, 1)
+	assert.Equal(t, ErrorSignature, allErrors[0].Kind)
+	assert.Equal(t, "refs/tags/unsigned", allErrors[0].Ref)
+	_, err = repository.Tag("unsigned")
+	assert.ErrorIs(t, err, git.ErrTagNotFound)
+}
+
+func Test_SetRepositorySignaturePolicy(t *testing.T) {
+	repositories := []RepositoryPair{{}, {VerifySignatures: SignaturePolicy{Branches: []string{}, SSHKeys: "keys"}}}
+	SetRepositorySignaturePolicy(&repositories, RepositoryPair{
+		VerifySignatures: SignaturePolicy{Keyring: "keyring.asc", Branches: []string{"main"}, Tags: true},
+	})
+	assert.Equal(t, SignaturePolicy{Keyring: "keyring.asc", Branches: []string{"main"}, Tags: true},
+		repositories[0].VerifySignatures)
+	assert.Equal(t, SignaturePolicy{Keyring: "keyring.asc", SSHKeys: "keys", Branches: []string{}, Tags: true},
+		repositories[1].VerifySignatures)
+	assert.True(t, repositories[0].VerifySignatures.coversBranch("main"))
+	assert.False(t, repositories[1].VerifySignatures.coversBranch("main"))
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	gitplumbing "github.com/go-git/go-git/v5/plumbing"
+	"github.com/sirupsen/logrus"
+)
+
+// refHashes returns hashes of branches and tags from refList, keyed by ref name.
+func refHashes(refList []*gitplumbing.Reference) map[string]string {
+	refs := make(map[string]string)
+	for _, ref := range refList {
+		name := ref.Name().String()
+		if ref.Type() == gitplumbing.HashReference &&
+			(strings.HasPrefix(name, refBranchPrefix) || strings.HasPrefix(name, refTagPrefix)) {
+			refs[name] = ref.Hash().String()
+		}
+	}
+	return refs
+}
+
+// GetSourceRefs returns hashes of branches and tags present in the source repository, which are mirrored
+// to the destination repository, keyed by ref name.
+// Refs are only listed, nothing is cloned.
+func (s *Syncer) GetSourceRefs(ctx context.Context, repositoryPair RepositoryPair,
+	logger *logrus.Entry) (map[string]string, error) {
+	timeout := repositoryPair.Retry.GetListTimeout()
+	nextAttempt := attemptLogger(logger.WithField("phase", "list"))
+	refList, err := backoff.RetryWithData(
+		func() ([]*gitplumbing.Reference, error) {
+			return s.ListRemote(ctx, repositoryPair.Source, timeout, nextAttempt())
+		},
+		repositoryPair.Retry.NewBackOff(ctx, defaultShortMaxElapsedTime),
+	)
+	if err != nil {
+		return nil, err
+	}
+	refs := refHashes(refList)
+	maps.DeleteFunc(refs, func(ref, _ string) bool { return !repositoryPair.mirrorsRef(ref) })
+	return refs, nil
+}
+
+// sourceUnchanged returns true if the last synchronization of repositoryPair succeeded, the branches and tags
+// in the source repository are the same as the ones pushed back then, and no full synchronization is due.
+func (s *Syncer) sourceUnchanged(ctx context.Context, repositoryPair RepositoryPair, previous *RepositoryState,
+	logger *logrus.Entry) bool {
+	if s.fullSyncInterval <= 0 || previous == nil || previous.Failed() || previous.Refs == nil {
+		return false
+	}
+	if time.Since(previous.LastFullSync) >= s.fullSyncInterval {
+		logger.Debug("Full synchronization is due.")
+		return false
+	}
+	sourceRefs, err := s.GetSourceRefs(ctx, repositoryPair, logger)
+	if err != nil {
+		// Errors are reported by the full synchronization.
+		logger.WithError(err).Debug("Cannot list source refs.")
+		return false
+	}
+	return maps.Equal(sourceRefs, previous.Refs)
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_sourceUnchanged(t *testing.T) {
+	repository, sourceDirectory, hash := newTestRepository(t)
+	head, err := repository.Head()
+	assert.NoError(t, err)
+
+	s := New(WithFullSyncInterval(time.Hour))
+	logger := logrus.WithField("source", sourceDirectory)
+	pair := RepositoryPair{Source: Repository{RepositoryURL: sourceDirectory}}
+	refs, err := s.GetSourceRefs(context.Background(), pair, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{head.Name().String(): hash.String()}, refs)
+
+	previous := &RepositoryState{LastFullSync: time.Now(), Refs: refs}
+	assert.True(t, s.sourceUnchanged(context.Background(), pair, previous, logger))
+	previous.LastFullSync = time.Now().Add(-2 * time.Hour)
+	assert.False(t, s.sourceUnchanged(context.Background(), pair, previous, logger))
+	previous = &RepositoryState{LastFullSync: time.Now(), Refs: map[string]string{"refs/heads/main": "0"}}
+	assert.False(t, s.sourceUnchanged(context.Background(), pair, previous, logger))
+	assert.False(t, s.sourceUnchanged(context.Background(), pair, nil, logger))
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const stateFileName = "state.json"
+
+// Operations recorded in the state. Importing bundles updates the destination like mirroring and shares its state,
+// while the other operations have their own, so that e.g. a successful backup does not hide a failed synchronization.
+const (
+	operationMirror  = "mirror"
+	operationBackup  = "backup"
+	operationExport  = "export"
+	operationRestore = "restore"
+)
+
+// OperationState records the outcome of the last backup, bundle export or restore of a repository pair.
+type OperationState struct {
+	LastAttempt time.Time   `json:"last_attempt"`
+	LastSuccess time.Time   `json:"last_success,omitzero"`
+	LastErrors  []SyncError `json:"last_errors,omitempty"`
+}
+
+// Failed returns true if the last attempt failed.
+func (o OperationState) Failed() bool {
+	return len(o.LastErrors) > 0
+}
+
+// record records the outcome of an attempt started at attempt.
+func (o *OperationState) record(status MirrorStatus, attempt time.Time) {
+	o.LastAttempt = attempt
+	o.LastErrors = status.Errors
+	if len(status.Errors) == 0 {
+		o.LastSuccess = attempt
+	}
+}
+
+// RepositoryState records the outcome of synchronization of a repository pair in previous runs.
+type RepositoryState struct {
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	LastAttempt time.Time `json:"last_attempt"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	// Last successful synchronization which has not been skipped because of unchanged source.
+	LastFullSync time.Time `json:"last_full_sync,omitzero"`
+	// Errors encountered during the last attempt.
+	LastErrors []SyncError `json:"last_errors,omitempty"`
+	// Hashes of branches and tags pushed during the last successful synchronization, keyed by ref name.
+	Refs map[string]string `json:"refs,omitempty"`
+	// Hashes of branches and tags included in the last exported bundle, keyed by ref name.
+	ExportedRefs map[string]string `json:"exported_refs,omitempty"`
+	// Manifest of the last snapshot written by Backup.
+	LastSnapshot string `json:"last_snapshot,omitempty"`
+	// Outcome of operations other than synchronization, which do not affect the fields above.
+	Backup  OperationState `json:"backup,omitzero"`
+	Export  OperationState `json:"export,omitzero"`
+	Restore OperationState `json:"restore,omitzero"`
+}
+
+// Failed returns true if the last synchronization attempt failed.
+func (r RepositoryState) Failed() bool {
+	return len(r.LastErrors) > 0
+}
+
+// failed returns true if the last attempt of operation failed.
+func (r RepositoryState) failed(operation string) bool {
+	switch operation {
+	case operationBackup:
+		return r.Backup.Failed()
+	case operationExport:
+		return r.Export.Failed()
+	case operationRestore:
+		return r.Restore.Failed()
+	}
+	return r.Failed()
+}
+
+// State is persisted in the working directory between runs.
+type State struct {
+	// State of the last run which has not been cancelled: success or failure.
+	LastRun      string            `json:"last_run,omitempty"`
+	Repositories []RepositoryState `json:"repositories"`
+}
+
+// Repository returns the state of the repository pair, or nil if it has never been synchronized.
+func (s *State) Repository(source, destination string) *RepositoryState {
+	for i := range s.Repositories {
+		if s.Repositories[i].Source == source && s.Repositories[i].Destination == destination {
+			return &s.Repositories[i]
+		}
+	}
+	return nil
+}
+
+// update records the outcome of operation on the repository pair. Cancelled operations are not recorded.
+func (s *State) update(status MirrorStatus, operation string, attempt time.Time) {
+	if status.Cancelled {
+		return
+	}
+	repository := s.Repository(status.Source, status.Destination)
+	if repository == nil {
+		s.Repositories = append(s.Repositories, RepositoryState{Source: status.Source, Destination: status.Destination})
+		repository = &s.Repositories[len(s.Repositories)-1]
+	}
+	success := len(status.Errors) == 0
+	switch operation {
+	case operationBackup:
+		repository.Backup.record(status, attempt)
+		if success {
+			repository.LastSnapshot = status.Snapshot
+		}
+	case operationExport:
+		repository.Export.record(status, attempt)
+		if success {
+			repository.ExportedRefs = status.ExportedRefs
+		}
+	case operationRestore:
+		repository.Restore.record(status, attempt)
+		// The destination no longer matches the refs pushed by the last synchronization, which must not be skipped.
+		repository.Refs = nil
+	default:
+		repository.LastAttempt = attempt
+		repository.LastErrors = status.Errors
+		if success {
+			repository.LastSuccess = attempt
+			repository.Refs = status.Refs
+			if !status.Skipped {
+				repository.LastFullSync = attempt
+			}
+		}
+	}
+}
+
+func (s *Syncer) statePath() string {
+	return filepath.Join(s.workingDirectory, stateFileName)
+}
+
+// LoadState reads the state of previous runs from the working directory. An empty state is returned
+// if no synchronization has been performed yet.
+func (s *Syncer) LoadState() (State, error) {
+	var state State
+	data, err := os.ReadFile(s.statePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// saveState atomically replaces the state file in the working directory.
+func (s *Syncer) saveState(state State) error {
+	sort.Slice(state.Repositories, func(i, j int) bool {
+		a, b := state.Repositories[i], state.Repositories[j]
+		return a.Source < b.Source || (a.Source == b.Source && a.Destination < b.Destination)
+	})
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporaryFile, err := os.CreateTemp(s.workingDirectory, stateFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporaryFile.Name())
+	if _, err = temporaryFile.Write(data); err != nil {
+		temporaryFile.Close()
+		return err
+	}
+	if err = temporaryFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporaryFile.Name(), s.statePath())
+}
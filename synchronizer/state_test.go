@@ -0,0 +1,68 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StateUpdate(t *testing.T) {
+	s := New(WithWorkingDirectory(t.TempDir()))
+	state, err := s.LoadState()
+	assert.NoError(t, err)
+	assert.Empty(t, state.Repositories)
+
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	refs := map[string]string{"refs/heads/main": "0123456789abcdef0123456789abcdef01234567"}
+	state.update(MirrorStatus{Source: "a", Destination: "b", Refs: refs}, operationMirror, first)
+	state.update(MirrorStatus{Source: "c", Destination: "d", Cancelled: true}, operationMirror, first)
+	pushFailed := []SyncError{{Kind: ErrorRejectedPush, Message: "push failed"}}
+	state.update(MirrorStatus{Source: "a", Destination: "b", Errors: pushFailed}, operationMirror, second)
+	assert.NoError(t, s.saveState(state))
+
+	state, err = s.LoadState()
+	assert.NoError(t, err)
+	assert.Equal(t, []RepositoryState{{
+		Source: "a", Destination: "b", LastAttempt: second, LastSuccess: first, LastFullSync: first,
+		LastErrors: pushFailed, Refs: refs,
+	}}, state.Repositories)
+	assert.True(t, state.Repository("a", "b").Failed())
+	assert.Nil(t, state.Repository("c", "d"))
+
+	// Backups, exports and restores do not affect the state of synchronization.
+	third := second.Add(time.Hour)
+	state.update(MirrorStatus{Source: "a", Destination: "b", Snapshot: "snapshot.json"}, operationBackup, third)
+	state.update(MirrorStatus{Source: "a", Destination: "b", ExportedRefs: refs}, operationExport, third)
+	restoreFailed := []SyncError{{Kind: ErrorAuth, Message: "authentication required"}}
+	state.update(MirrorStatus{Source: "a", Destination: "b", Errors: restoreFailed}, operationRestore, third)
+	repository := state.Repository("a", "b")
+	assert.Equal(t, second, repository.LastAttempt)
+	assert.Equal(t, first, repository.LastSuccess)
+	assert.Equal(t, first, repository.LastFullSync)
+	assert.Equal(t, pushFailed, repository.LastErrors)
+	assert.Equal(t, OperationState{LastAttempt: third, LastSuccess: third}, repository.Backup)
+	assert.Equal(t, "snapshot.json", repository.LastSnapshot)
+	assert.Equal(t, refs, repository.ExportedRefs)
+	assert.Equal(t, OperationState{LastAttempt: third, LastErrors: restoreFailed}, repository.Restore)
+	assert.True(t, repository.failed(operationRestore))
+	assert.False(t, repository.failed(operationExport))
+	// The next synchronization is not skipped after restoring a snapshot.
+	assert.Nil(t, repository.Refs)
+}
@@ -0,0 +1,319 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package synchronizer mirrors branches and tags of git repositories from one location to another.
+// It is the engine behind the git-synchronizer command line tool and can be embedded in other programs.
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AuthMethodToken authenticates with a Personal Access Token read from an environment variable.
+const AuthMethodToken = "token"
+
+// RepositoryPair describes source repository and destination repository to which it is mirrored.
+type RepositoryPair struct {
+	// Name of the repository, from which its URLs are derived if they are not specified.
+	Name        string      `mapstructure:"name" yaml:"name"`
+	Source      Repository  `mapstructure:"source" yaml:"source"`
+	Destination Repository  `mapstructure:"destination" yaml:"destination"`
+	Retry       RetryPolicy `mapstructure:"retry" yaml:"retry"`
+	// Templates of source and destination URLs of named repositories, e.g. https://gitlab.example.com/org-5/{{.Name}}.
+	SourceBase      string `mapstructure:"source_base" yaml:"source_base"`
+	DestinationBase string `mapstructure:"destination_base" yaml:"destination_base"`
+	// If true, branches protected in the destination GitLab project are temporarily unprotected
+	// when pushing to or deleting them is rejected.
+	UnprotectBranches bool `mapstructure:"unprotect_branches" yaml:"unprotect_branches"`
+	// Either mirror (default) or additive, in which case nothing is removed from the destination.
+	Mode string `mapstructure:"mode" yaml:"mode"`
+	// Patterns of branch and tag names which are never removed from the destination, e.g. internal/*.
+	Preserve []string `mapstructure:"preserve" yaml:"preserve"`
+	// Either force (default), immutable or skip.
+	TagPolicy string `mapstructure:"tag_policy" yaml:"tag_policy"`
+	// If true, only tags are synchronized and branches in the destination are left untouched.
+	TagsOnly bool `mapstructure:"tags_only" yaml:"tags_only"`
+	// Branches and tags which are only pushed if they are signed by trusted keys.
+	VerifySignatures SignaturePolicy `mapstructure:"verify_signatures" yaml:"verify_signatures"`
+	// Labels by which repositories can be selected, e.g. the team owning them.
+	Labels []string `mapstructure:"labels" yaml:"labels"`
+}
+
+type Repository struct {
+	RepositoryURL string         `mapstructure:"repo" yaml:"repo"`
+	Auth          Authentication `mapstructure:"auth" yaml:"auth"`
+	// URL of the HTTP proxy used to connect to the repository, e.g. http://proxy.example.com:3128.
+	// By default, HTTPS_PROXY and related environment variables are used.
+	Proxy string      `mapstructure:"proxy" yaml:"proxy"`
+	TLS   TLSSettings `mapstructure:"tls" yaml:"tls"`
+	// Either go-git (default) or exec, in which case the git binary is used to access the repository.
+	Transport string `mapstructure:"transport" yaml:"transport"`
+}
+
+type Authentication struct {
+	Method    string `mapstructure:"method" yaml:"method"`
+	TokenName string `mapstructure:"token_name" yaml:"token_name"`
+}
+
+// Config is the list of repositories to be synchronized, together with default settings
+// applied to repositories which do not override them.
+type Config struct {
+	Defaults     RepositoryPair   `mapstructure:"defaults" yaml:"defaults"`
+	Repositories []RepositoryPair `mapstructure:"repositories" yaml:"repositories"`
+}
+
+// Syncer mirrors repositories. It should be created with New.
+type Syncer struct {
+	workingDirectory string
+	gracePeriod      time.Duration
+	fullSyncInterval time.Duration
+	logger           logrus.FieldLogger
+	progress         ProgressReporter
+	// Notifications sent when synchronization completes.
+	notificationRules []NotificationRule
+}
+
+// Option configures Syncer.
+type Option func(*Syncer)
+
+// WithWorkingDirectory sets the directory where repositories are temporarily cloned.
+func WithWorkingDirectory(workingDirectory string) Option {
+	return func(s *Syncer) {
+		s.workingDirectory = workingDirectory
+	}
+}
+
+// WithGracePeriod sets the time given to operations in progress to complete after the context
+// passed to Syncer methods is cancelled.
+func WithGracePeriod(gracePeriod time.Duration) Option {
+	return func(s *Syncer) {
+		s.gracePeriod = gracePeriod
+	}
+}
+
+// WithFullSyncInterval sets the maximum time between full synchronizations of a repository pair. Until then,
+// Mirror skips cloning and pushing repositories whose source branches and tags have not changed since the last
+// successful synchronization. Zero disables skipping.
+func WithFullSyncInterval(fullSyncInterval time.Duration) Option {
+	return func(s *Syncer) {
+		s.fullSyncInterval = fullSyncInterval
+	}
+}
+
+// WithProgress sets the reporter receiving updates about repository pairs being synchronized.
+func WithProgress(progress ProgressReporter) Option {
+	return func(s *Syncer) {
+		s.progress = progress
+	}
+}
+
+// WithLogger sets the logger used for all messages. By default, the standard logrus logger is used.
+func WithLogger(logger logrus.FieldLogger) Option {
+	return func(s *Syncer) {
+		s.logger = logger
+	}
+}
+
+// WithNotifications sets notifiers to which events are sent when synchronization completes.
+func WithNotifications(rules ...NotificationRule) Option {
+	return func(s *Syncer) {
+		s.notificationRules = rules
+	}
+}
+
+// New returns Syncer configured with opts.
+func New(opts ...Option) *Syncer {
+	s := &Syncer{
+		workingDirectory: os.TempDir(),
+		gracePeriod:      30 * time.Second,
+		fullSyncInterval: 24 * time.Hour,
+		logger:           logrus.StandardLogger(),
+		progress:         noProgress{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Resolve returns repositories from config with default settings applied. URLs which cannot be expanded
+// from the templates are left empty, use SetRepositoryURLs to find out why.
+func (c Config) Resolve() []RepositoryPair {
+	repositories := append([]RepositoryPair(nil), c.Repositories...)
+	_ = SetRepositoryURLs(&repositories, c.Defaults)
+	SetRepositoryAuth(&repositories, c.Defaults)
+	SetRepositoryRetryPolicy(&repositories, c.Defaults)
+	SetRepositoryRefPolicy(&repositories, c.Defaults)
+	SetRepositorySignaturePolicy(&repositories, c.Defaults)
+	SetRepositoryLabels(&repositories, c.Defaults)
+	SetRepositoryConnectionSettings(&repositories, c.Defaults)
+	return repositories
+}
+
+// Result summarizes synchronization of all repositories.
+type Result struct {
+	// Status of each repository, in the same order as the repositories passed to Mirror.
+	Repositories []MirrorStatus
+	// Time between the start of synchronization and the end of the last clone.
+	CloneDuration time.Duration
+	// Total synchronization time (wall-clock time).
+	Duration time.Duration
+	// Sum of clone and push durations of all repositories (goroutine time).
+	TotalCloneDuration time.Duration
+	TotalPushDuration  time.Duration
+}
+
+// Errors returns errors encountered while synchronizing repositories which have not been cancelled.
+func (r Result) Errors() []SyncError {
+	var allErrors []SyncError
+	for _, status := range r.Repositories {
+		if !status.Cancelled {
+			allErrors = append(allErrors, status.Errors...)
+		}
+	}
+	return allErrors
+}
+
+// Cancelled returns statuses of repositories whose synchronization has been cancelled.
+func (r Result) Cancelled() []MirrorStatus {
+	var cancelled []MirrorStatus
+	for _, status := range r.Repositories {
+		if status.Cancelled {
+			cancelled = append(cancelled, status)
+		}
+	}
+	return cancelled
+}
+
+// State returns failure if synchronization of any repository failed, cancelled if synchronization
+// of any repository has been cancelled, and success otherwise.
+func (r Result) State() string {
+	state := StateSuccess
+	for _, status := range r.Repositories {
+		switch status.getState() {
+		case StateFailure:
+			return StateFailure
+		case StateCancelled:
+			state = StateCancelled
+		}
+	}
+	return state
+}
+
+// Mirror ensures that branches and tags from source repository are mirrored to the destination
+// repository for each repositoryPair. Repositories which have not been fully synchronized when ctx
+// is cancelled are reported separately from the failed ones. The returned error is not nil if
+// synchronization of any repository failed or has been cancelled.
+func (s *Syncer) Mirror(ctx context.Context, repos []RepositoryPair) (Result, error) {
+	return s.run(ctx, repos, "Mirroring", operationMirror, s.mirrorRepository)
+}
+
+// repositoryOperation processes a single repository pair and sends its status to messages. previous is the state
+// recorded for the repository pair in earlier runs, or nil.
+type repositoryOperation func(ctx context.Context, messages chan MirrorStatus, repositoryPair RepositoryPair,
+	previous *RepositoryState)
+
+// run executes operation concurrently for each repositoryPair, then reports the result and records it
+// in the synchronization state under kind. activity describes the operation in log messages.
+func (s *Syncer) run(ctx context.Context, repos []RepositoryPair, activity, kind string,
+	operation repositoryOperation) (Result, error) {
+	var result Result
+	if err := os.MkdirAll(s.workingDirectory, os.ModePerm); err != nil {
+		return result, err
+	}
+	state, err := s.LoadState()
+	if err != nil {
+		s.logger.WithError(err).Warn("Cannot read synchronization state.")
+	}
+	messages := make(chan MirrorStatus, 100)
+	synchronizationStart := time.Now()
+	for _, repository := range repos {
+		s.logger.WithFields(logrus.Fields{
+			"source": repository.Source.RepositoryURL, "destination": repository.Destination.RepositoryURL,
+		}).Info(activity, " repository.")
+		go operation(ctx, messages, repository,
+			state.Repository(repository.Source.RepositoryURL, repository.Destination.RepositoryURL))
+	}
+	statuses := make(map[[2]string]MirrorStatus)
+	var lastCloneEnd time.Time
+	skipped := 0
+	for receivedResults := 1; receivedResults <= len(repos); receivedResults++ {
+		msg := <-messages
+		s.logger.Info("Finished ", strings.ToLower(activity), " ", receivedResults, " out of ", len(repos), " repositories.")
+		statuses[[2]string{msg.Source, msg.Destination}] = msg
+		if lastCloneEnd.Before(msg.LastCloneEnd) {
+			lastCloneEnd = msg.LastCloneEnd
+		}
+		result.TotalCloneDuration += msg.CloneDuration
+		result.TotalPushDuration += msg.PushDuration
+		if msg.Skipped {
+			skipped++
+		}
+	}
+	for _, repository := range repos {
+		result.Repositories = append(result.Repositories,
+			statuses[[2]string{repository.Source.RepositoryURL, repository.Destination.RepositoryURL}])
+	}
+	result.CloneDuration = lastCloneEnd.Sub(synchronizationStart)
+	result.Duration = time.Since(synchronizationStart)
+	s.logger.Infof("Last clone finished %v after synchronization had started (%.1f%% of total synchronization time).",
+		result.CloneDuration.Round(time.Second),
+		(float64(100)*result.CloneDuration.Seconds())/result.Duration.Seconds())
+	for _, status := range result.Repositories {
+		if len(status.PreservedRefs) > 0 {
+			s.logger.WithFields(logrus.Fields{
+				"source": status.Source, "destination": status.Destination, "refs": status.PreservedRefs,
+			}).Info("Preserved ", len(status.PreservedRefs), " refs not present in the source repository.")
+		}
+		if len(status.Tags) > 0 {
+			annotated, moved := countTags(status.Tags)
+			s.logger.WithFields(logrus.Fields{
+				"source": status.Source, "destination": status.Destination,
+				"annotated": annotated, "lightweight": len(status.Tags) - annotated, "moved": moved,
+			}).Info("Source repository has ", len(status.Tags), " tags, ", moved, " of them moved.")
+		}
+	}
+	if skipped > 0 {
+		s.logger.Info("Skipped ", skipped, " repositories whose source has not changed since the last synchronization.")
+	}
+	s.logger.Infof("Synchronization took %v (wall-clock time).", result.Duration.Round(time.Second))
+	s.logger.Debugf("Total clone duration: %v (goroutine time).", result.TotalCloneDuration.Round(time.Second))
+	s.logger.Debugf("Total push duration: %v (goroutine time).", result.TotalPushDuration.Round(time.Second))
+
+	s.notify(ctx, result, state, kind)
+	for _, status := range result.Repositories {
+		state.update(status, kind, synchronizationStart)
+	}
+	if runState := result.State(); runState != StateCancelled && kind == operationMirror {
+		state.LastRun = runState
+	}
+	if err := s.saveState(state); err != nil {
+		s.logger.WithError(err).Warn("Cannot save synchronization state.")
+	}
+
+	allErrors, cancelled := result.Errors(), result.Cancelled()
+	if len(allErrors) > 0 || len(cancelled) > 0 {
+		return result, fmt.Errorf("%d errors encountered, synchronization of %d repositories cancelled",
+			len(allErrors), len(cancelled))
+	}
+	return result, nil
+}
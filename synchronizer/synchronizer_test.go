@@ -0,0 +1,64 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synchronizer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ConfigResolve(t *testing.T) {
+	config := Config{
+		Defaults: RepositoryPair{
+			Source: Repository{Auth: Authentication{AuthMethodToken, "GITHUB_TOKEN"}},
+			Retry:  RetryPolicy{MaxAttempts: 3},
+		},
+		Repositories: []RepositoryPair{
+			{Source: Repository{RepositoryURL: "https://example.com/org-1/repo-1"}},
+		},
+	}
+	repositories := config.Resolve()
+	assert.Equal(t, "GITHUB_TOKEN", repositories[0].Source.Auth.TokenName)
+	assert.Equal(t, uint64(3), repositories[0].Retry.MaxAttempts)
+	// Original configuration is not modified.
+	assert.Equal(t, "", config.Repositories[0].Source.Auth.Method)
+}
+
+func Test_ResultErrors(t *testing.T) {
+	result := Result{Repositories: []MirrorStatus{
+		{Source: "a", Errors: []SyncError{{Kind: ErrorOther, Message: "error 1"}}},
+		{Source: "b", Errors: []SyncError{{Kind: ErrorNetwork, Message: "context canceled"}}, Cancelled: true},
+		{Source: "c", LastCloneEnd: time.Now()},
+	}}
+	assert.Equal(t, []SyncError{{Kind: ErrorOther, Message: "error 1"}}, result.Errors())
+	assert.Len(t, result.Cancelled(), 1)
+	assert.Equal(t, "b", result.Cancelled()[0].Source)
+}
+
+func Test_ValidateRepositories(t *testing.T) {
+	s := New()
+	assert.NoError(t, s.ValidateRepositories([]RepositoryPair{
+		{Destination: Repository{RepositoryURL: "https://example.com/org-2/repo-1"}},
+		{Destination: Repository{RepositoryURL: "https://example.com/org-2/repo-2"}},
+	}))
+	assert.Error(t, s.ValidateRepositories([]RepositoryPair{
+		{Destination: Repository{RepositoryURL: "https://example.com/org-2/repo-1"}},
+		{Destination: Repository{RepositoryURL: "https://example.com/org-2/repo-1"}},
+	}))
+}
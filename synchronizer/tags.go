@@ -0,0 +1,235 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	git "github.com/go-git/go-git/v5"
+	gitplumbing "github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/sirupsen/logrus"
+)
+
+// TagPolicyForce overwrites tags in the destination repository with the ones from the source repository.
+const TagPolicyForce = "force"
+
+// TagPolicyImmutable never changes tags already present in the destination repository. Tags which point
+// to a different commit in the source repository are reported as moved.
+const TagPolicyImmutable = "immutable"
+
+// TagPolicySkip neither pushes nor removes any tags.
+const TagPolicySkip = "skip"
+
+// ErrMovedTag is reported for tags which have been moved in the source repository, if the tag policy is immutable.
+var ErrMovedTag = errors.New("tag has been moved in the source repository")
+
+// TagStatus describes a tag present in the source repository.
+type TagStatus struct {
+	Name string
+	// True for annotated tags, false for lightweight ones.
+	Annotated bool
+	// True if the tag points to a different commit in the destination repository, and has not been pushed
+	// because of the immutable tag policy.
+	Moved bool
+	// True if the tag has not been pushed because its signature could not be verified.
+	Unverified bool
+}
+
+// countTags returns numbers of annotated and moved tags among tags.
+func countTags(tags []TagStatus) (int, int) {
+	annotated, moved := 0, 0
+	for _, tag := range tags {
+		if tag.Annotated {
+			annotated++
+		}
+		if tag.Moved {
+			moved++
+		}
+	}
+	return annotated, moved
+}
+
+// mirrorsRef returns true if ref (full name) is pushed to the destination repository according to
+// the tag policy and tags only setting of the repository pair.
+func (p RepositoryPair) mirrorsRef(ref string) bool {
+	if strings.HasPrefix(ref, refBranchPrefix) {
+		return !p.TagsOnly
+	}
+	return p.TagPolicy != TagPolicySkip
+}
+
+// localTags returns tags present in repository, and objects they point to, keyed by tag name.
+// Annotated tags are peeled, so that they can be compared with lightweight tags.
+func localTags(repository *git.Repository) ([]TagStatus, map[string]gitplumbing.Hash, error) {
+	var tags []TagStatus
+	targets := make(map[string]gitplumbing.Hash)
+	iter, err := repository.Tags()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = iter.ForEach(func(ref *gitplumbing.Reference) error {
+		name := strings.TrimPrefix(ref.Name().String(), refTagPrefix)
+		target := ref.Hash()
+		tagObject, err := repository.TagObject(target)
+		annotated := err == nil
+		for err == nil {
+			target = tagObject.Target
+			if tagObject.TargetType != gitplumbing.TagObject {
+				break
+			}
+			tagObject, err = repository.TagObject(target)
+		}
+		if err != nil && !errors.Is(err, gitplumbing.ErrObjectNotFound) {
+			return err
+		}
+		tags = append(tags, TagStatus{Name: name, Annotated: annotated})
+		targets[name] = target
+		return nil
+	})
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, targets, err
+}
+
+// peeledTags returns objects pointed to by tags in advertisedRefs, keyed by tag name.
+// Annotated tags are peeled if the server advertises peeled refs.
+func peeledTags(advertisedRefs *packp.AdvRefs) map[string]gitplumbing.Hash {
+	targets := make(map[string]gitplumbing.Hash)
+	for name, hash := range advertisedRefs.References {
+		if strings.HasPrefix(name, refTagPrefix) {
+			targets[strings.TrimPrefix(name, refTagPrefix)] = hash
+		}
+	}
+	for name, hash := range advertisedRefs.Peeled {
+		if strings.HasPrefix(name, refTagPrefix) {
+			targets[strings.TrimPrefix(name, refTagPrefix)] = hash
+		}
+	}
+	return targets
+}
+
+// GetPeeledTags returns objects pointed to by tags in repository, keyed by tag name.
+// Annotated tags are peeled.
+func (s *Syncer) GetPeeledTags(ctx context.Context, repository Repository,
+	retryPolicy RetryPolicy, logger *logrus.Entry) (map[string]gitplumbing.Hash, error) {
+	timeout := retryPolicy.GetListTimeout()
+	nextAttempt := attemptLogger(logger.WithField("phase", "list"))
+	// Only git-upload-pack advertises peeled tags.
+	advertisedRefs, err := backoff.RetryWithData(
+		func() (*packp.AdvRefs, error) {
+			return s.advertisedReferences(ctx, repository, false, timeout, nextAttempt())
+		},
+		retryPolicy.NewBackOff(ctx, defaultShortMaxElapsedTime),
+	)
+	if errors.Is(err, gittransport.ErrEmptyRemoteRepository) {
+		return map[string]gitplumbing.Hash{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return peeledTags(advertisedRefs), nil
+}
+
+// sameTagTarget returns true if destinationTarget advertised for a tag by the destination repository is the peeled
+// target of the local tag or, if the destination does not advertise peeled refs, the local tag object itself.
+func sameTagTarget(destinationTarget, target, tagObject gitplumbing.Hash) bool {
+	return destinationTarget == target || destinationTarget == tagObject
+}
+
+// withholdExistingTags removes tags already present in the destination repository from the local repository,
+// so that they are not overwritten by the push. Tags which point to a different commit in the destination
+// repository are marked as moved in tags and reported as errors. Hashes of the remaining ones are recorded
+// in refs, as if they were pushed.
+func (s *Syncer) withholdExistingTags(ctx context.Context, repository *git.Repository,
+	repositoryPair RepositoryPair, tags []TagStatus, targets map[string]gitplumbing.Hash, refs map[string]string,
+	logger *logrus.Entry, allErrors *[]SyncError) error {
+	destination := repositoryPair.Destination.RepositoryURL
+	destinationTargets, err := s.GetPeeledTags(ctx, repositoryPair.Destination, repositoryPair.Retry, logger)
+	if err != nil {
+		return err
+	}
+	for i, tag := range tags {
+		destinationTarget, ok := destinationTargets[tag.Name]
+		if !ok || tag.Unverified {
+			continue
+		}
+		tagLog := logger.WithField("ref", refTagPrefix+tag.Name)
+		ref, err := repository.Reference(gitplumbing.NewTagReferenceName(tag.Name), false)
+		if err != nil {
+			return err
+		}
+		if !sameTagTarget(destinationTarget, targets[tag.Name], ref.Hash()) {
+			tags[i].Moved = true
+			ProcessError(tagLog, fmt.Errorf("%w: %s in source, %s in destination", ErrMovedTag,
+				targets[tag.Name], destinationTarget), "pushing tag "+tag.Name+" to ", destination, allErrors)
+		} else {
+			tagLog.Debug("Tag already present in the destination repository.")
+			refs[ref.Name().String()] = ref.Hash().String()
+		}
+		if err = repository.Storer.RemoveReference(ref.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushTags pushes tags from the local repository to the destination repository according to the tag policy
+// and signature verification policy of the repository pair, and returns the tags present in the source repository.
+func (s *Syncer) pushTags(ctx context.Context, repository *git.Repository, repositoryPair RepositoryPair,
+	verifier *signatureVerifier, timeout time.Duration, logger *logrus.Entry,
+	status *MirrorStatus, allErrors *[]SyncError) []TagStatus {
+	destination := repositoryPair.Destination.RepositoryURL
+	tags, targets, err := localTags(repository)
+	if err != nil {
+		ProcessError(logger, err, "reading tags to be pushed to ", destination, allErrors)
+		return nil
+	}
+	tagsLog := logger.WithField("ref", refTagPrefix+"*")
+	if verifier != nil && repositoryPair.VerifySignatures.Tags {
+		if err = verifier.withholdUnverifiedTags(repository, tags, destination, logger, allErrors); err != nil {
+			ProcessError(tagsLog, err, "verifying signatures of tags to be pushed to ", destination, allErrors)
+			return tags
+		}
+	}
+	if repositoryPair.TagPolicy == TagPolicyImmutable {
+		err = s.withholdExistingTags(ctx, repository, repositoryPair, tags, targets, status.Refs, logger, allErrors)
+		if err != nil {
+			ProcessError(tagsLog, err, "getting tags from ", destination, allErrors)
+			return tags
+		}
+	}
+	tagsLog.Info("Pushing all tags.")
+	nextPushTagsAttempt := attemptLogger(tagsLog)
+	err = backoff.Retry(
+		func() error {
+			return s.PushRefs(
+				ctx, repository, repositoryPair.Destination, "+"+refTagPrefix+"*:"+refTagPrefix+"*", timeout, nextPushTagsAttempt(),
+			)
+		},
+		repositoryPair.Retry.NewBackOff(ctx, defaultShortMaxElapsedTime),
+	)
+	ProcessError(tagsLog, err, "pushing all tags to ", destination, allErrors)
+	if err == nil || err == git.NoErrAlreadyUpToDate {
+		addPushedRefs(repository, refTagPrefix, status.Refs)
+	}
+	return tags
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	git "github.com/go-git/go-git/v5"
+	gitplumbing "github.com/go-git/go-git/v5/plumbing"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_localTags(t *testing.T) {
+	repository, directory, hash := newTestRepository(t)
+	_, err := repository.CreateTag("v1.0", hash, nil)
+	assert.NoError(t, err)
+	_, err = repository.CreateTag("v1.1", hash, &git.CreateTagOptions{Tagger: testSignature(), Message: "Release 1.1"})
+	assert.NoError(t, err)
+
+	tags, targets, err := localTags(repository)
+	assert.NoError(t, err)
+	assert.Equal(t, []TagStatus{{Name: "v1.0"}, {Name: "v1.1", Annotated: true}}, tags)
+	assert.Equal(t, map[string]gitplumbing.Hash{"v1.0": hash, "v1.1": hash}, targets)
+
+	s := New()
+	peeled, err := s.GetPeeledTags(context.Background(), Repository{RepositoryURL: directory}, RetryPolicy{},
+		logrus.WithField("destination", directory))
+	assert.NoError(t, err)
+	assert.Equal(t, targets, peeled)
+
+	// Servers which do not advertise peeled refs advertise the annotated tag object.
+	ref, err := repository.Tag("v1.1")
+	assert.NoError(t, err)
+	assert.True(t, sameTagTarget(peeled["v1.1"], targets["v1.1"], ref.Hash()))
+	assert.True(t, sameTagTarget(ref.Hash(), targets["v1.1"], ref.Hash()))
+	assert.False(t, sameTagTarget(gitplumbing.ZeroHash, targets["v1.1"], ref.Hash()))
+}
+
+func Test_countTags(t *testing.T) {
+	annotated, moved := countTags([]TagStatus{
+		{Name: "v1.0"}, {Name: "v1.1", Annotated: true, Moved: true}, {Name: "v1.2", Annotated: true},
+	})
+	assert.Equal(t, 2, annotated)
+	assert.Equal(t, 1, moved)
+}
+
+func Test_mirrorsRef(t *testing.T) {
+	for _, tc := range []struct {
+		pair     RepositoryPair
+		branches bool
+		tags     bool
+	}{
+		{RepositoryPair{}, true, true},
+		{RepositoryPair{TagsOnly: true, TagPolicy: TagPolicyImmutable}, false, true},
+		{RepositoryPair{TagPolicy: TagPolicySkip}, true, false},
+	} {
+		t.Run(fmt.Sprintf("%+v", tc.pair), func(t *testing.T) {
+			assert.Equal(t, tc.branches, tc.pair.mirrorsRef(refBranchPrefix+"main"))
+			assert.Equal(t, tc.tags, tc.pair.mirrorsRef(refTagPrefix+"v1.0"))
+		})
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// urlTemplateData is available in source_base and destination_base templates.
+type urlTemplateData struct {
+	Name string
+}
+
+// expandURLTemplate returns the URL of repository name according to template base,
+// e.g. https://gitlab.example.com/org-5/{{.Name}}.
+func expandURLTemplate(base, name string) (string, error) {
+	t, err := template.New("url").Option("missingkey=error").Parse(base)
+	if err != nil {
+		return "", err
+	}
+	var url strings.Builder
+	if err = t.Execute(&url, urlTemplateData{name}); err != nil {
+		return "", err
+	}
+	return url.String(), nil
+}
+
+// SetRepositoryURLs ensures that repositories for which the URL templates have not been overridden,
+// use the default ones from config file, and sets the URLs of named repositories which do not specify them
+// from the templates. The first error encountered while expanding the templates is returned,
+// and the URLs which cannot be expanded are left empty.
+func SetRepositoryURLs(repositories *[]RepositoryPair, defaultSettings RepositoryPair) error {
+	var firstErr error
+	for i := 0; i < len(*repositories); i++ {
+		repository := &(*repositories)[i]
+		if repository.SourceBase == "" {
+			repository.SourceBase = defaultSettings.SourceBase
+		}
+		if repository.DestinationBase == "" {
+			repository.DestinationBase = defaultSettings.DestinationBase
+		}
+		if repository.Name == "" {
+			continue
+		}
+		for _, u := range []struct {
+			url  *string
+			base string
+			kind string
+		}{
+			{&repository.Source.RepositoryURL, repository.SourceBase, "source"},
+			{&repository.Destination.RepositoryURL, repository.DestinationBase, "destination"},
+		} {
+			if *u.url != "" || u.base == "" {
+				continue
+			}
+			url, err := expandURLTemplate(u.base, repository.Name)
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("cannot expand %s URL template of repository %s: %w", u.kind, repository.Name, err)
+			}
+			*u.url = url
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SetRepositoryURLs(t *testing.T) {
+	repositories := []RepositoryPair{
+		{Name: "repo-1"},
+		{Name: "repo-2", Destination: Repository{RepositoryURL: "https://gitlab.example.com/archive/repo-2"}},
+		{Name: "repo-3", SourceBase: "https://github.example.com/org-2/{{.Name}}.git"},
+		{Source: Repository{RepositoryURL: "https://github.example.com/org-1/repo-4"}},
+	}
+	assert.NoError(t, SetRepositoryURLs(&repositories, RepositoryPair{
+		SourceBase:      "https://github.example.com/org-1/{{.Name}}",
+		DestinationBase: "https://gitlab.example.com/org-5/{{.Name}}",
+	}))
+	for i, urls := range [][2]string{
+		{"https://github.example.com/org-1/repo-1", "https://gitlab.example.com/org-5/repo-1"},
+		{"https://github.example.com/org-1/repo-2", "https://gitlab.example.com/archive/repo-2"},
+		{"https://github.example.com/org-2/repo-3.git", "https://gitlab.example.com/org-5/repo-3"},
+		{"https://github.example.com/org-1/repo-4", ""},
+	} {
+		assert.Equal(t, urls, [2]string{repositories[i].Source.RepositoryURL, repositories[i].Destination.RepositoryURL})
+	}
+
+	repositories = []RepositoryPair{{Name: "repo-1", SourceBase: "https://github.example.com/{{.Org}}/{{.Name}}"}}
+	assert.ErrorContains(t, SetRepositoryURLs(&repositories, RepositoryPair{}),
+		"cannot expand source URL template of repository repo-1")
+	assert.Empty(t, repositories[0].Source.RepositoryURL)
+}
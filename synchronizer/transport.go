@@ -0,0 +1,483 @@
+/*
+Copyright 2024 F. Hoffmann-La Roche AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package synchronizer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	git "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	gitplumbing "github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	gitclient "github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// TransportGoGit accesses repositories with the built-in git implementation. It is the default transport.
+const TransportGoGit = "go-git"
+
+// TransportExec accesses repositories by running the git binary, which supports protocol v2, SSH configuration
+// from ~/.ssh/config and credential helpers.
+const TransportExec = "exec"
+
+// Transports lists all supported transports.
+var Transports = []string{TransportGoGit, TransportExec}
+
+// gitTransport performs operations on remote repositories. Each call is a single attempt,
+// the callers decide whether it is retried.
+type gitTransport interface {
+	// clone clones remote into gitDirectory.
+	clone(ctx context.Context, gitDirectory string, remote Repository, progress io.Writer) (*git.Repository, error)
+	// list returns refs present in remote.
+	list(ctx context.Context, remote Repository) ([]*gitplumbing.Reference, error)
+	// advertise returns refs advertised by git-upload-pack of remote, including peeled tags if the server
+	// advertises them, or by git-receive-pack if forPush is true.
+	advertise(ctx context.Context, remote Repository, forPush bool) (*packp.AdvRefs, error)
+	// fetch fetches refs matching refSpec from remote into repository.
+	fetch(ctx context.Context, repository *git.Repository, remote Repository, refSpec string, progress io.Writer) error
+	// push updates refs of remote matching refSpec, even if they are not fast-forwarded, in a single atomic push.
+	// git.NoErrAlreadyUpToDate is returned if there is nothing to update.
+	push(ctx context.Context, repository *git.Repository, remote Repository, refSpec string, progress io.Writer) error
+}
+
+// transport returns the transport through which the repository is accessed.
+func (r Repository) transport() gitTransport {
+	if r.Transport == TransportExec {
+		return execTransport{}
+	}
+	return goGitTransport{}
+}
+
+// ValidateTransport checks that the transport of the repository is supported.
+func (r Repository) ValidateTransport() error {
+	if r.Transport == "" || stringInSlice(r.Transport, Transports) {
+		return nil
+	}
+	return errors.New("unknown transport " + r.Transport + ", supported transports are: " +
+		strings.Join(Transports, ", "))
+}
+
+// isPermanent returns true if err has been marked as one which retrying cannot fix.
+func isPermanent(err error) bool {
+	var permanent *backoff.PermanentError
+	return errors.As(err, &permanent)
+}
+
+// goGitTransport accesses repositories with go-git.
+type goGitTransport struct{}
+
+func (goGitTransport) clone(ctx context.Context, gitDirectory string, remote Repository,
+	progress io.Writer) (*git.Repository, error) {
+	cloneOptions, err := GetCloneOptions(remote)
+	if err != nil {
+		return nil, backoff.Permanent(err)
+	}
+	cloneOptions.Progress = progress
+	return git.PlainCloneContext(ctx, gitDirectory, false, cloneOptions)
+}
+
+func (goGitTransport) list(ctx context.Context, remote Repository) ([]*gitplumbing.Reference, error) {
+	listOptions, err := GetListOptions(remote)
+	if err != nil {
+		return nil, backoff.Permanent(err)
+	}
+	// Listing refs requires a remote, so an in-memory one is used.
+	return git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: "origin", URLs: []string{remote.RepositoryURL},
+	}).ListContext(ctx, listOptions)
+}
+
+func (goGitTransport) advertise(ctx context.Context, remote Repository, forPush bool) (*packp.AdvRefs, error) {
+	endpoint, err := gittransport.NewEndpoint(remote.RepositoryURL)
+	if err != nil {
+		return nil, backoff.Permanent(err)
+	}
+	connection, err := remote.connectionOptions()
+	if err != nil {
+		return nil, backoff.Permanent(err)
+	}
+	connection.setEndpoint(endpoint)
+	auth := GetDestinationAuth(remote.Auth)
+	transportClient, err := gitclient.NewClient(endpoint)
+	if err != nil {
+		return nil, backoff.Permanent(err)
+	}
+	var session gittransport.Session
+	if forPush {
+		session, err = transportClient.NewReceivePackSession(endpoint, auth)
+	} else {
+		session, err = transportClient.NewUploadPackSession(endpoint, auth)
+	}
+	if err != nil {
+		return nil, backoff.Permanent(err)
+	}
+	defer session.Close()
+	return session.AdvertisedReferencesContext(ctx)
+}
+
+func (goGitTransport) fetch(ctx context.Context, repository *git.Repository, remote Repository, refSpec string,
+	progress io.Writer) error {
+	fetchOptions, err := GetFetchOptions(refSpec, remote)
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+	fetchOptions.Progress = progress
+	return git.NewRemote(repository.Storer, &gitconfig.RemoteConfig{
+		Name: "origin", URLs: []string{remote.RepositoryURL},
+	}).FetchContext(ctx, fetchOptions)
+}
+
+func (goGitTransport) push(ctx context.Context, repository *git.Repository, remote Repository, refSpec string,
+	progress io.Writer) error {
+	connection, err := remote.connectionOptions()
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+	// Messages explaining why the push has been rejected are only sent by the server over the progress channel.
+	remoteMessages := &remoteMessageWriter{}
+	var pushProgress io.Writer = remoteMessages
+	if progress != nil {
+		pushProgress = io.MultiWriter(remoteMessages, progress)
+	}
+	err = git.NewRemote(repository.Storer, &gitconfig.RemoteConfig{
+		Name: "destination", URLs: []string{remote.RepositoryURL},
+	}).PushContext(ctx, &git.PushOptions{
+		RemoteName:      "destination",
+		RefSpecs:        []gitconfig.RefSpec{gitconfig.RefSpec(refSpec)},
+		Progress:        pushProgress,
+		Auth:            GetDestinationAuth(remote.Auth),
+		Force:           true,
+		Atomic:          true,
+		CABundle:        connection.caBundle,
+		ClientCert:      connection.clientCert,
+		ClientKey:       connection.clientKey,
+		InsecureSkipTLS: connection.insecureSkipTLS,
+		ProxyOptions:    connection.proxy,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		err = remoteMessages.wrap(err)
+	}
+	return err
+}
+
+// execTransport accesses repositories by running the git binary.
+type execTransport struct{}
+
+// gitErrorMarkers map messages printed by git to the errors returned by go-git in the same situation,
+// so that they are classified in the same way.
+var gitErrorMarkers = []struct {
+	markers []string
+	err     error
+}{
+	{[]string{"authentication failed", "could not read username", "could not read password",
+		"terminal prompts disabled", "permission denied (publickey"}, gittransport.ErrAuthenticationRequired},
+	{[]string{"returned error: 403"}, gittransport.ErrAuthorizationFailed},
+	{[]string{"repository not found", "' not found", "does not appear to be a git repository",
+		"returned error: 404"}, gittransport.ErrRepositoryNotFound},
+}
+
+// systemCABundles are the files in which operating systems commonly store the system CA certificates,
+// in the order in which Go looks for them.
+var systemCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// writeCABundle writes the system CA certificates followed by the ones from caBundle to a temporary file
+// and returns its path. git trusts only the certificates in http.sslCAInfo, while go-git trusts the ones
+// from ca_bundle in addition to the system ones. As in Go, SSL_CERT_FILE overrides the system certificates.
+func writeCABundle(caBundle string) (string, error) {
+	data, err := os.ReadFile(caBundle)
+	if err != nil {
+		return "", err
+	}
+	for _, systemBundle := range append([]string{os.Getenv("SSL_CERT_FILE")}, systemCABundles...) {
+		if systemData, readErr := os.ReadFile(systemBundle); readErr == nil {
+			data = append(append(systemData, '\n'), data...)
+			break
+		}
+	}
+	file, err := os.CreateTemp("", "ca-bundle-*.pem")
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// gitEnvironment returns environment variables configuring git to connect to remote with its authentication,
+// proxy and TLS settings. Settings are passed through the environment rather than command line arguments,
+// so that tokens are not visible in the list of processes.
+func gitEnvironment(remote Repository) ([]string, error) {
+	if _, err := remote.connectionOptions(); err != nil {
+		return nil, err
+	}
+	var config [][2]string
+	if token := getPersonalAccessToken(remote.Auth); token != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(basicAuthUsername + ":" + token))
+		config = append(config, [2]string{"http.extraHeader", "Authorization: Basic " + credentials})
+	}
+	for _, setting := range [][2]string{
+		{"http.proxy", remote.Proxy},
+		{"http.sslCAInfo", remote.TLS.CABundle},
+		{"http.sslCert", remote.TLS.ClientCert},
+		{"http.sslKey", remote.TLS.ClientKey},
+	} {
+		if setting[1] != "" {
+			config = append(config, setting)
+		}
+	}
+	if remote.TLS.SkipVerify() {
+		config = append(config, [2]string{"http.sslVerify", "false"})
+	}
+	// Messages are parsed, so they must not be translated. Prompting for credentials would block synchronization.
+	environment := append(os.Environ(), "LC_ALL=C", "GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT="+strconv.Itoa(len(config)))
+	for i, setting := range config {
+		environment = append(environment, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, setting[0]),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, setting[1]))
+	}
+	return environment, nil
+}
+
+// run runs git command with args, in the repository stored in directory unless it is empty, and returns
+// its standard output. Messages printed by git are copied to progress.
+func (execTransport) run(ctx context.Context, remote Repository, directory string, progress io.Writer,
+	command string, args ...string) ([]byte, error) {
+	if remote.TLS.CABundle != "" {
+		caBundle, err := writeCABundle(remote.TLS.CABundle)
+		if err != nil {
+			return nil, backoff.Permanent(err)
+		}
+		defer os.Remove(caBundle)
+		remote.TLS.CABundle = caBundle
+	}
+	environment, err := gitEnvironment(remote)
+	if err != nil {
+		return nil, backoff.Permanent(err)
+	}
+	var commandLine []string
+	if directory != "" {
+		commandLine = append(commandLine, "--git-dir", directory)
+	}
+	commandLine = append(commandLine, command)
+	if progress != nil && command != "ls-remote" {
+		commandLine = append(commandLine, "--progress")
+	}
+	commandLine = append(commandLine, args...)
+	// #nosec G204 -- arguments are passed to git directly, without a shell.
+	gitCommand := exec.CommandContext(ctx, "git", commandLine...)
+	gitCommand.Env = environment
+	messages := &remoteMessageWriter{}
+	gitCommand.Stderr = messages
+	if progress != nil {
+		gitCommand.Stderr = io.MultiWriter(messages, progress)
+	}
+	var stdout bytes.Buffer
+	gitCommand.Stdout = &stdout
+	err = gitCommand.Run()
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		return nil, backoff.Permanent(err)
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case err != nil:
+		return nil, gitCommandError(command, messages.messages, err)
+	case command == "push" && stringInSlice("Everything up-to-date", messages.messages):
+		return nil, git.NoErrAlreadyUpToDate
+	}
+	return stdout.Bytes(), nil
+}
+
+// gitCommandError returns error describing failed git command, based on the messages it has printed.
+func gitCommandError(command string, messages []string, err error) error {
+	// The progress of git clone is not relevant to the error.
+	messages = slices.DeleteFunc(slices.Clone(messages), func(message string) bool {
+		return strings.HasPrefix(message, "Cloning into")
+	})
+	if len(messages) == 0 {
+		return fmt.Errorf("git %s: %w", command, err)
+	}
+	message := strings.Join(messages, " ")
+	lowerMessage := strings.ToLower(message)
+	for _, marker := range gitErrorMarkers {
+		if containsAny(lowerMessage, marker.markers) {
+			return fmt.Errorf("%w (git %s: %s)", marker.err, command, message)
+		}
+	}
+	return errors.New("git " + command + ": " + message)
+}
+
+// repositoryDirectory returns the directory in which repository is stored.
+func repositoryDirectory(repository *git.Repository) (string, error) {
+	storage, ok := repository.Storer.(*filesystem.Storage)
+	if !ok {
+		return "", backoff.Permanent(errors.New("the exec transport requires a repository stored on disk"))
+	}
+	return storage.Filesystem().Root(), nil
+}
+
+// clone creates a bare clone, which contains all branches and tags of remote. As opposed to clone --mirror,
+// other refs such as merge requests, which are never pushed to the destination, are not fetched.
+func (t execTransport) clone(ctx context.Context, gitDirectory string, remote Repository,
+	progress io.Writer) (*git.Repository, error) {
+	// Files left by a previous attempt would make git clone fail.
+	if err := cleanDirectory(gitDirectory); err != nil {
+		return nil, backoff.Permanent(err)
+	}
+	_, err := t.run(ctx, remote, "", progress, "clone", "--bare", "--", remote.RepositoryURL, gitDirectory)
+	if err != nil {
+		return nil, err
+	}
+	return git.PlainOpen(gitDirectory)
+}
+
+func (t execTransport) list(ctx context.Context, remote Repository) ([]*gitplumbing.Reference, error) {
+	advertisedRefs, err := t.listRemote(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	if len(advertisedRefs.References) == 0 {
+		return nil, gittransport.ErrEmptyRemoteRepository
+	}
+	var refList []*gitplumbing.Reference
+	for name, hash := range advertisedRefs.References {
+		refList = append(refList, gitplumbing.NewHashReference(gitplumbing.ReferenceName(name), hash))
+	}
+	return refList, nil
+}
+
+// listRemote returns refs and peeled tags printed by git ls-remote for remote.
+func (t execTransport) listRemote(ctx context.Context, remote Repository) (*packp.AdvRefs, error) {
+	output, err := t.run(ctx, remote, "", nil, "ls-remote", "--", remote.RepositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	advertisedRefs := packp.NewAdvRefs()
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		hash, name, found := strings.Cut(scanner.Text(), "\t")
+		if !found {
+			continue
+		}
+		// Peeled tags are listed after the tags themselves.
+		if tagName, peeled := strings.CutSuffix(name, "^{}"); peeled {
+			advertisedRefs.Peeled[tagName] = gitplumbing.NewHash(hash)
+		} else {
+			advertisedRefs.References[name] = gitplumbing.NewHash(hash)
+		}
+	}
+	return advertisedRefs, scanner.Err()
+}
+
+// noRefsInCommon is printed by git push if there is nothing to push to an empty remote, after its refs
+// have been listed.
+const noRefsInCommon = "No refs in common and none specified"
+
+// checkPush verifies that remote accepts pushes by pushing matching branches of an empty repository,
+// that is nothing, with --dry-run.
+// git ls-remote only lists refs through git-upload-pack, which does not require permissions to push.
+func (t execTransport) checkPush(ctx context.Context, remote Repository) error {
+	directory, err := os.MkdirTemp("", "")
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+	defer os.RemoveAll(directory)
+	if _, err = git.PlainInit(directory, true); err != nil {
+		return backoff.Permanent(err)
+	}
+	_, err = t.run(ctx, remote, directory, nil, "push", "--dry-run", "--", remote.RepositoryURL, ":")
+	if errors.Is(err, git.NoErrAlreadyUpToDate) || err != nil && strings.Contains(err.Error(), noRefsInCommon) {
+		return nil
+	}
+	return err
+}
+
+func (t execTransport) advertise(ctx context.Context, remote Repository, forPush bool) (*packp.AdvRefs, error) {
+	if forPush {
+		if err := t.checkPush(ctx, remote); err != nil {
+			return nil, err
+		}
+	}
+	advertisedRefs, err := t.listRemote(ctx, remote)
+	if err == nil && !forPush && len(advertisedRefs.References) == 0 {
+		// Like go-git, only git-receive-pack advertises empty repositories without an error.
+		return nil, gittransport.ErrEmptyRemoteRepository
+	}
+	return advertisedRefs, err
+}
+
+func (t execTransport) fetch(ctx context.Context, repository *git.Repository, remote Repository, refSpec string,
+	progress io.Writer) error {
+	directory, err := repositoryDirectory(repository)
+	if err != nil {
+		return err
+	}
+	// Like go-git, fetch updates the branch HEAD points to.
+	_, err = t.run(ctx, remote, directory, progress, "fetch", "--update-head-ok", "--", remote.RepositoryURL, refSpec)
+	return err
+}
+
+func (t execTransport) push(ctx context.Context, repository *git.Repository, remote Repository, refSpec string,
+	progress io.Writer) error {
+	directory, err := repositoryDirectory(repository)
+	if err != nil {
+		return err
+	}
+	_, err = t.run(ctx, remote, directory, progress, "push", "--force", "--atomic", "--", remote.RepositoryURL,
+		refSpec)
+	return err
+}
+
+// cleanDirectory removes contents of directory.
+func cleanDirectory(directory string) error {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err = os.RemoveAll(filepath.Join(directory, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}